@@ -0,0 +1,511 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/sftp"
+	"github.com/pmezard/go-difflib/difflib"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Format des noms de version (date de la sauvegarde, triable).
+const backupVersionFormat = "20060102-150405"
+
+// Nom du fichier .backup créé temporairement sur le routeur.
+const backupRemoteName = "mikromap"
+
+// Version sauvegardée de la configuration d'un routeur.
+// Chaque version est composée d'un export texte (<version>.rsc) et éventuellement d'un fichier binaire (<version>.backup).
+type BackupVersion struct {
+	Version string    `json:"version"` // ex: 20240301-020000
+	Date    time.Time `json:"date"`
+	Export  int64     `json:"export"`           // Taille de l'export en octets
+	Backup  int64     `json:"backup,omitempty"` // Taille du fichier .backup en octets, 0 s'il n'a pas été récupéré
+}
+
+// Renvoie le dossier des sauvegardes d'un routeur.
+// Prend en entrée l'IP du routeur (string) et renvoie le chemin du dossier (string).
+func backupDir(ip string) string {
+	return filepath.Join(confPath(getConfig().Backup.Dir), ip)
+}
+
+// Liste les versions sauvegardées d'un routeur, de la plus ancienne à la plus récente.
+// Prend en entrée l'IP du routeur (string) et renvoie les versions ([]BackupVersion), vide si aucune sauvegarde n'existe.
+func listBackups(ip string) ([]BackupVersion, error) {
+
+	var res []BackupVersion
+
+	entries, err := os.ReadDir(backupDir(ip))
+	if errors.Is(err, os.ErrNotExist) {
+		return res, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make(map[string]*BackupVersion)
+	for _, e := range entries {
+		name, ext, _ := strings.Cut(e.Name(), ".")
+		date, err := time.ParseInLocation(backupVersionFormat, name, time.Local)
+		if err != nil || (ext != "rsc" && ext != "backup") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		v, ok := versions[name]
+		if !ok {
+			v = &BackupVersion{Version: name, Date: date}
+			versions[name] = v
+		}
+		if ext == "rsc" {
+			v.Export = info.Size()
+		} else {
+			v.Backup = info.Size()
+		}
+	}
+
+	for _, v := range versions {
+		if v.Export > 0 {
+			res = append(res, *v)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Version < res[j].Version
+	})
+
+	return res, nil
+}
+
+// Retire les lignes d'en-tête d'un export qui changent à chaque exécution (date et version de RouterOS).
+// Prend en entrée l'export ([]byte) et renvoie l'export sans ces lignes ([]byte).
+func stripExportHeader(export []byte) []byte {
+
+	var res [][]byte
+	for _, line := range bytes.Split(export, []byte("\n")) {
+		if bytes.HasPrefix(line, []byte("# ")) && bytes.Contains(line, []byte(" by RouterOS ")) {
+			continue
+		}
+		res = append(res, line)
+	}
+
+	return bytes.Join(res, []byte("\n"))
+}
+
+// Ouvre une connexion SSH vers un routeur.
+// Prend en entrée un contexte (context.Context), l'adresse à joindre (string), les identifiants (Credentials) et la configuration (BackupConfig),
+// renvoie le client SSH (*ssh.Client) ou une erreur.
+func dialSSH(ctx context.Context, host string, creds Credentials, conf BackupConfig) (*ssh.Client, error) {
+
+	// Méthodes d'authentification
+	var auth []ssh.AuthMethod
+	if conf.Key != "" {
+		key, err := os.ReadFile(confPath(conf.Key))
+		if err != nil {
+			return nil, fmt.Errorf("lecture de la clé SSH: %w", err)
+		}
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("clé SSH invalide: %w", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if creds.Password != "" {
+		auth = append(auth, ssh.Password(creds.Password))
+	}
+
+	// Vérification de la clé du routeur: sans known_hosts, la connexion est refusée sauf si insecure_host_key est activé,
+	// le mot de passe pouvant sinon être envoyé à n'importe qui.
+	var hostKey ssh.HostKeyCallback
+	switch {
+	case conf.KnownHosts != "":
+		callback, err := knownhosts.New(confPath(conf.KnownHosts))
+		if err != nil {
+			return nil, fmt.Errorf("lecture de known_hosts: %w", err)
+		}
+		hostKey = callback
+	case conf.InsecureHostKey:
+		hostKey = ssh.InsecureIgnoreHostKey()
+	default:
+		return nil, fmt.Errorf("backup.known_hosts non renseigné, impossible de vérifier la clé SSH du routeur")
+	}
+
+	port := creds.Port
+	if port == 0 {
+		port = 22
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+
+	dialer := &net.Dialer{Timeout: time.Second * 10}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(time.Minute * 2))
+
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, addr, &ssh.ClientConfig{
+		User:            creds.Username,
+		Auth:            auth,
+		HostKeyCallback: hostKey,
+		Timeout:         time.Second * 10,
+	})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return ssh.NewClient(sshConn, chans, reqs), nil
+}
+
+// Exécute une commande RouterOS via SSH.
+// Prend en entrée le client SSH (*ssh.Client) et la commande (string), renvoie la sortie de la commande ([]byte) ou une erreur.
+func runSSH(client *ssh.Client, cmd string) ([]byte, error) {
+
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	out, err := session.CombinedOutput(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", cmd, err)
+	}
+
+	return out, nil
+}
+
+// Récupère l'export de la configuration d'un routeur et, si demandé, un fichier .backup.
+// Prend en entrée un contexte (context.Context), l'adresse à joindre (string), les identifiants (Credentials) et la configuration (BackupConfig),
+// renvoie l'export ([]byte), le fichier .backup ([]byte, nil s'il n'est pas demandé) ou une erreur.
+func fetchBackup(ctx context.Context, host string, creds Credentials, conf BackupConfig) ([]byte, []byte, error) {
+
+	client, err := dialSSH(ctx, host, creds, conf)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer client.Close()
+
+	// Export texte
+	export, err := runSSH(client, "/export")
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(bytes.TrimSpace(export)) == 0 {
+		return nil, nil, errors.New("export vide")
+	}
+	if !conf.Binary {
+		return export, nil, nil
+	}
+
+	// Fichier .backup: créé sur le routeur, récupéré par SFTP puis supprimé
+	_, err = runSSH(client, fmt.Sprintf("/system backup save name=%s dont-encrypt=yes", backupRemoteName))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer runSSH(client, fmt.Sprintf("/file remove %s.backup", backupRemoteName))
+
+	sftpClient, err := sftp.NewClient(client)
+	if err != nil {
+		return nil, nil, fmt.Errorf("sftp: %w", err)
+	}
+	defer sftpClient.Close()
+
+	file, err := sftpClient.Open(backupRemoteName + ".backup")
+	if err != nil {
+		return nil, nil, fmt.Errorf("sftp: %w", err)
+	}
+	defer file.Close()
+
+	binary, err := io.ReadAll(file)
+	if err != nil {
+		return nil, nil, fmt.Errorf("sftp: %w", err)
+	}
+
+	return export, binary, nil
+}
+
+// Enregistre une nouvelle version de la configuration d'un routeur.
+// Prend en entrée l'IP du routeur (string), l'export ([]byte) et le fichier .backup ([]byte, optionnel),
+// renvoie true si une nouvelle version a été créée, false si l'export est identique au précédent (hors en-tête), ou une erreur.
+func storeBackup(ip string, export []byte, binary []byte) (bool, error) {
+
+	dir := backupDir(ip)
+
+	// Comparaison avec la dernière version
+	versions, err := listBackups(ip)
+	if err != nil {
+		return false, err
+	}
+	if len(versions) > 0 {
+		last, err := os.ReadFile(filepath.Join(dir, versions[len(versions)-1].Version+".rsc"))
+		if err == nil && bytes.Equal(stripExportHeader(last), stripExportHeader(export)) {
+			return false, nil
+		}
+	}
+
+	// Ecriture
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return false, err
+	}
+	version := time.Now().Format(backupVersionFormat)
+	if binary != nil {
+		err = os.WriteFile(filepath.Join(dir, version+".backup"), binary, 0600)
+		if err != nil {
+			return false, err
+		}
+	}
+	err = os.WriteFile(filepath.Join(dir, version+".rsc"), export, 0600)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Supprime les versions qui dépassent les règles de rétention.
+// Prend en entrée l'IP du routeur (string) et la configuration (BackupConfig), renvoie le nombre de versions supprimées (int) ou une erreur.
+// La version la plus récente est toujours conservée.
+func pruneBackups(ip string, conf BackupConfig) (int, error) {
+
+	versions, err := listBackups(ip)
+	if err != nil {
+		return 0, err
+	}
+
+	var removed int
+	for i, v := range versions[:max(len(versions)-1, 0)] {
+		tooMany := conf.Keep > 0 && len(versions)-i > conf.Keep
+		tooOld := conf.MaxAge > 0 && time.Since(v.Date) > time.Duration(conf.MaxAge)
+		if !tooMany && !tooOld {
+			continue
+		}
+		for _, ext := range []string{".rsc", ".backup"} {
+			err := os.Remove(filepath.Join(backupDir(ip), v.Version+ext))
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return removed, err
+			}
+		}
+		removed++
+	}
+
+	return removed, nil
+}
+
+// Boucle de sauvegarde des routeurs.
+// Prend en entrée un contexte (context.Context) dont l'annulation arrête la boucle, et ne renvoie rien.
+// Seuls les routeurs sous RouterOS (voir DeviceProfile), up et pour lesquels des identifiants SSH sont configurés sont sauvegardés.
+// La configuration est relue à chaque tour, les sauvegardes peuvent donc être activées ou désactivées par SIGHUP.
+func pollBackups(ctx context.Context) {
+
+	for {
+		config := getConfig()
+		conf := config.Backup
+
+		// Sans known_hosts, les sauvegardes ne sont faites qu'avec insecure_host_key, et un avertissement est levé à chaque tour.
+		if conf.Enabled && conf.KnownHosts == "" {
+			if conf.InsecureHostKey {
+				logger.Warn("clés SSH des routeurs acceptées sans vérification (backup.insecure_host_key): les identifiants peuvent être interceptés")
+			} else {
+				logger.Error("sauvegardes désactivées: renseigner backup.known_hosts pour vérifier la clé SSH des routeurs")
+				conf.Enabled = false
+			}
+		}
+
+		if conf.Enabled {
+			for _, v := range inventory.snapshot() {
+				creds := conf.credentials(v.IP)
+				if v.Statut != statutUp || creds.Username == "" || !config.isRouterOS(v) {
+					continue
+				}
+				if ctx.Err() != nil {
+					return
+				}
+
+				host := v.IP
+				if v.Resolu != "" {
+					host = v.Resolu
+				}
+
+				export, binary, err := fetchBackup(ctx, host, creds, conf)
+				if err != nil {
+					routerLogger(v).Warn("erreur lors de la sauvegarde de la configuration", "error", err)
+					continue
+				}
+				created, err := storeBackup(v.IP, export, binary)
+				if err != nil {
+					routerLogger(v).Error("erreur lors de l'enregistrement de la sauvegarde", "dir", backupDir(v.IP), "error", err)
+					continue
+				}
+				removed, err := pruneBackups(v.IP, conf)
+				if err != nil {
+					routerLogger(v).Error("erreur lors de la suppression des anciennes sauvegardes", "dir", backupDir(v.IP), "error", err)
+				}
+				if created {
+					routerLogger(v).Info("configuration sauvegardée", "removed", removed)
+				} else {
+					routerLogger(v).Debug("configuration inchangée depuis la dernière sauvegarde", "removed", removed)
+				}
+			}
+		}
+
+		// Pas plus d'une sauvegarde toutes les 10 minutes, même si l'intervalle configuré est plus court
+		interval := time.Duration(conf.Interval)
+		if interval < time.Minute*10 {
+			interval = time.Minute * 10
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Vérifie qu'un routeur est visible par l'utilisateur de la requête.
+// Prend en entrée le writer (http.ResponseWriter) et la requête (*http.Request), renvoie l'IP du routeur (string) et false si une erreur 404 a été envoyée.
+// Vérifier l'IP dans l'inventaire empêche aussi de sortir du dossier des sauvegardes avec un chemin forgé.
+func requestRouter(writer http.ResponseWriter, request *http.Request) (string, bool) {
+
+	ip := mux.Vars(request)["ip"]
+	user := request.URL.Query().Get("user")
+
+	if !slices.ContainsFunc(visibleRouters(user), func(r Router) bool { return r.IP == ip }) {
+		http.Error(writer, "routeur inconnu", http.StatusNotFound)
+		return "", false
+	}
+
+	return ip, true
+}
+
+// Traite les requêtes HTTP GET sur /api/v1/routers/{ip}/backups.
+// Renvoie les versions sauvegardées du routeur, de la plus ancienne à la plus récente.
+// Prend en entrée un http.responseWriter et un pointeur *http.Request.
+func getBackups(writer http.ResponseWriter, request *http.Request) {
+
+	ip, ok := requestRouter(writer, request)
+	if !ok {
+		return
+	}
+
+	versions, err := listBackups(ip)
+	if err != nil {
+		requestLogger(request).Error("erreur lors de la lecture des sauvegardes", "ip", ip, "error", err)
+		http.Error(writer, "erreur lors de la lecture des sauvegardes", http.StatusInternalServerError)
+		return
+	}
+	if versions == nil {
+		versions = []BackupVersion{}
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(writer).Encode(versions)
+	if err != nil {
+		requestLogger(request).Warn("erreur lors de l'envoi de la réponse", "ip", ip, "error", err)
+	}
+}
+
+// Traite les requêtes HTTP GET sur /api/v1/routers/{ip}/backups/{version}.{ext}.
+// Renvoie l'export (rsc) ou le fichier .backup (backup) d'une version.
+// Prend en entrée un http.responseWriter et un pointeur *http.Request.
+func getBackupFile(writer http.ResponseWriter, request *http.Request) {
+
+	ip, ok := requestRouter(writer, request)
+	if !ok {
+		return
+	}
+	vars := mux.Vars(request)
+
+	// Le format du nom est vérifié par la route, la version ne peut pas contenir de séparateur de chemin
+	name := vars["version"] + "." + vars["ext"]
+	if vars["ext"] == "rsc" {
+		writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	} else {
+		writer.Header().Set("Content-Type", "application/octet-stream")
+	}
+	writer.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", strings.ReplaceAll(ip, ":", "_")+"-"+name))
+
+	http.ServeFile(writer, request, filepath.Join(backupDir(ip), name))
+}
+
+// Traite les requêtes HTTP GET sur /api/v1/routers/{ip}/backups/diff.
+// Renvoie la différence (format unifié) entre deux exports, par défaut les deux plus récents.
+// Les paramètres from et to permettent de choisir les versions comparées.
+// Prend en entrée un http.responseWriter et un pointeur *http.Request.
+func getBackupDiff(writer http.ResponseWriter, request *http.Request) {
+
+	ip, ok := requestRouter(writer, request)
+	if !ok {
+		return
+	}
+
+	versions, err := listBackups(ip)
+	if err != nil {
+		requestLogger(request).Error("erreur lors de la lecture des sauvegardes", "ip", ip, "error", err)
+		http.Error(writer, "erreur lors de la lecture des sauvegardes", http.StatusInternalServerError)
+		return
+	}
+
+	// Versions comparées
+	from, to := request.URL.Query().Get("from"), request.URL.Query().Get("to")
+	if from == "" || to == "" {
+		if len(versions) < 2 {
+			http.Error(writer, "moins de deux versions sauvegardées", http.StatusNotFound)
+			return
+		}
+		if from == "" {
+			from = versions[len(versions)-2].Version
+		}
+		if to == "" {
+			to = versions[len(versions)-1].Version
+		}
+	}
+	var exports [2][]byte
+	for i, v := range []string{from, to} {
+		if !slices.ContainsFunc(versions, func(b BackupVersion) bool { return b.Version == v }) {
+			http.Error(writer, fmt.Sprintf("version %s inconnue", v), http.StatusNotFound)
+			return
+		}
+		exports[i], err = os.ReadFile(filepath.Join(backupDir(ip), v+".rsc"))
+		if err != nil {
+			requestLogger(request).Error("erreur lors de la lecture d'une sauvegarde", "ip", ip, "version", v, "error", err)
+			http.Error(writer, "erreur lors de la lecture des sauvegardes", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Sans l'en-tête, qui contient la date de l'export et changerait à chaque version
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(stripExportHeader(exports[0]))),
+		B:        difflib.SplitLines(string(stripExportHeader(exports[1]))),
+		FromFile: from + ".rsc",
+		ToFile:   to + ".rsc",
+		Context:  3,
+	})
+	if err != nil {
+		http.Error(writer, "erreur lors du calcul de la différence", http.StatusInternalServerError)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "text/x-diff; charset=utf-8")
+	io.WriteString(writer, diff)
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Configure un dossier de sauvegardes temporaire.
+// Prend en entrée le test (*testing.T) et la configuration des sauvegardes (BackupConfig, Dir est remplacé), renvoie le chemin du dossier (string).
+func tempBackups(t *testing.T, conf BackupConfig) string {
+
+	previous := currentConfig.Load()
+	t.Cleanup(func() { currentConfig.Store(previous) })
+
+	conf.Dir = t.TempDir()
+	currentConfig.Store(&Config{Backup: conf})
+
+	return conf.Dir
+}
+
+// Ecrit un fichier de sauvegarde d'un routeur.
+// Prend en entrée le test (*testing.T), l'IP du routeur (string), le nom du fichier (string) et son contenu (string), ne renvoie rien.
+func writeBackup(t *testing.T, ip string, name string, content string) {
+
+	if err := os.MkdirAll(backupDir(ip), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(backupDir(ip), name), []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStripExportHeader(t *testing.T) {
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"en-tête", "# mar/01/2024 02:00:00 by RouterOS 7.14\n# software id = ABCD-1234\n/system identity\nset name=R1\n", "# software id = ABCD-1234\n/system identity\nset name=R1\n"},
+		{"format 7.x", "# 2024-03-01 02:00:00 by RouterOS 7.15.1\n/ip address\n", "/ip address\n"},
+		{"sans en-tête", "/system identity\nset name=R1", "/system identity\nset name=R1"},
+		{"commentaires ordinaires", "# software id = ABCD-1234\n#by RouterOS 7.14\n# by RouterOS\n", "# software id = ABCD-1234\n#by RouterOS 7.14\n# by RouterOS\n"},
+		{"vide", "", ""},
+	}
+	for _, tt := range tests {
+		if got := string(stripExportHeader([]byte(tt.in))); got != tt.want {
+			t.Errorf("%s: stripExportHeader = %q, attendu %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestListBackups(t *testing.T) {
+
+	tempBackups(t, BackupConfig{})
+	ip := "10.0.0.1"
+
+	if versions, err := listBackups(ip); err != nil || len(versions) != 0 {
+		t.Fatalf("sans sauvegarde: %v, %v", versions, err)
+	}
+
+	writeBackup(t, ip, "20240302-020000.rsc", "bb")
+	writeBackup(t, ip, "20240301-020000.rsc", "a")
+	writeBackup(t, ip, "20240301-020000.backup", "binaire")
+	writeBackup(t, ip, "20240303-020000.backup", "sans export") // Ignoré: pas d'export
+	writeBackup(t, ip, "20240304-020000.txt", "autre extension")
+	writeBackup(t, ip, "notes.rsc", "nom invalide")
+	writeBackup(t, ip, ".20240305-020000.rsc", "fichier caché")
+
+	versions, err := listBackups(ip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []BackupVersion{
+		{Version: "20240301-020000", Export: 1, Backup: 7},
+		{Version: "20240302-020000", Export: 2},
+	}
+	if len(versions) != len(want) {
+		t.Fatalf("versions = %+v, attendu %+v", versions, want)
+	}
+	for i, v := range versions {
+		date, _ := time.ParseInLocation(backupVersionFormat, want[i].Version, time.Local)
+		if v.Version != want[i].Version || v.Export != want[i].Export || v.Backup != want[i].Backup || !v.Date.Equal(date) {
+			t.Errorf("version %d = %+v, attendu %+v", i, v, want[i])
+		}
+	}
+}
+
+func TestStoreBackup(t *testing.T) {
+
+	tempBackups(t, BackupConfig{})
+	ip := "10.0.0.1"
+	writeBackup(t, ip, "20240301-020000.rsc", "# mar/01/2024 02:00:00 by RouterOS 7.14\n/system identity\nset name=R1\n")
+
+	tests := []struct {
+		name    string
+		export  string
+		created bool
+	}{
+		{"seul l'en-tête change", "# mar/02/2024 02:00:00 by RouterOS 7.14\n/system identity\nset name=R1\n", false},
+		{"configuration modifiée", "# mar/02/2024 02:00:00 by RouterOS 7.14\n/system identity\nset name=R2\n", true},
+	}
+	for _, tt := range tests {
+		created, err := storeBackup(ip, []byte(tt.export), nil)
+		if err != nil || created != tt.created {
+			t.Errorf("%s: storeBackup = %v, %v, attendu %v", tt.name, created, err, tt.created)
+		}
+	}
+
+	versions, err := listBackups(ip)
+	if err != nil || len(versions) != 2 {
+		t.Errorf("versions = %+v, %v, attendu 2 versions", versions, err)
+	}
+}
+
+func TestPruneBackups(t *testing.T) {
+
+	day := 24 * time.Hour
+
+	tests := []struct {
+		name    string
+		conf    BackupConfig
+		ages    []int // Âge des versions en jours, de la plus ancienne à la plus récente
+		removed int
+	}{
+		{"tout garder", BackupConfig{}, []int{40, 20, 10, 1}, 0},
+		{"nombre maximum", BackupConfig{Keep: 2}, []int{40, 20, 10, 1}, 2},
+		{"nombre non atteint", BackupConfig{Keep: 5}, []int{40, 20, 10, 1}, 0},
+		{"âge maximum", BackupConfig{MaxAge: Duration(15 * day)}, []int{40, 20, 10, 1}, 2},
+		{"nombre et âge", BackupConfig{Keep: 3, MaxAge: Duration(30 * day)}, []int{40, 20, 10, 1}, 1},
+		{"dernière version trop vieille", BackupConfig{MaxAge: Duration(15 * day)}, []int{40, 20}, 1},
+		{"une seule version", BackupConfig{Keep: 1, MaxAge: Duration(day)}, []int{40}, 0},
+		{"aucune version", BackupConfig{Keep: 1}, nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempBackups(t, tt.conf)
+			ip := "10.0.0.1"
+			var names []string
+			for _, age := range tt.ages {
+				name := time.Now().Add(-time.Duration(age) * day).Format(backupVersionFormat)
+				writeBackup(t, ip, name+".rsc", "export")
+				writeBackup(t, ip, name+".backup", "binaire")
+				names = append(names, name)
+			}
+
+			removed, err := pruneBackups(ip, tt.conf)
+			if err != nil || removed != tt.removed {
+				t.Fatalf("pruneBackups = %d, %v, attendu %d", removed, err, tt.removed)
+			}
+
+			// Les versions les plus anciennes sont supprimées, avec leur fichier .backup
+			versions, _ := listBackups(ip)
+			if len(versions) != len(names)-tt.removed {
+				t.Fatalf("%d versions restantes, attendu %d", len(versions), len(names)-tt.removed)
+			}
+			for i, v := range versions {
+				if v.Version != names[tt.removed+i] || v.Backup == 0 {
+					t.Errorf("version restante %d = %+v, attendu %s avec son .backup", i, v, names[tt.removed+i])
+				}
+			}
+			for _, name := range names[:tt.removed] {
+				if _, err := os.Stat(filepath.Join(backupDir(ip), name+".backup")); !os.IsNotExist(err) {
+					t.Errorf("%s.backup non supprimé", name)
+				}
+			}
+		})
+	}
+}
+
+func TestGetBackupDiff(t *testing.T) {
+
+	tempBackups(t, BackupConfig{})
+	ip := "10.0.0.1"
+	previous := inventory.snapshot()
+	inventory.mu.Lock()
+	inventory.routers = []Router{{IP: ip}}
+	inventory.mu.Unlock()
+	t.Cleanup(func() {
+		inventory.mu.Lock()
+		inventory.routers = previous
+		inventory.mu.Unlock()
+	})
+
+	writeBackup(t, ip, "20240301-020000.rsc", "# mar/01/2024 02:00:00 by RouterOS 7.14\n/system identity\nset name=R1\n")
+	writeBackup(t, ip, "20240302-020000.rsc", "# mar/02/2024 02:00:00 by RouterOS 7.15\n/system identity\nset name=R2\n")
+
+	router := mux.NewRouter()
+	router.HandleFunc("/api/v1/routers/{ip}/backups/diff", getBackupDiff)
+
+	tests := []struct {
+		name   string
+		query  string
+		status int
+	}{
+		{"deux dernières versions", "user=admin", http.StatusOK},
+		{"versions choisies", "user=admin&from=20240301-020000&to=20240302-020000", http.StatusOK},
+		{"version inconnue", "user=admin&from=20240101-000000", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/routers/"+ip+"/backups/diff?"+tt.query, nil))
+			if rec.Code != tt.status {
+				t.Fatalf("statut %d, attendu %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			diff := rec.Body.String()
+			if !strings.Contains(diff, "-set name=R1\n") || !strings.Contains(diff, "+set name=R2\n") {
+				t.Errorf("différence incomplète:\n%s", diff)
+			}
+			if strings.Contains(diff, "by RouterOS") {
+				t.Errorf("l'en-tête de l'export apparaît dans la différence:\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Politique de versions RouterOS (section compliance de mikromap.json).
+type CompliancePolicy struct {
+	Channels map[string]string `json:"channels"` // Canal (stable, long-term, testing...) -> version minimum, ex: {"stable": "7.14.2"}
+	Blocked  []string          `json:"blocked"`  // Versions interdites, motifs acceptés (ex: "7.13", "7.12.*")
+}
+
+// Conformité d'un routeur à la politique de versions.
+type Compliance struct {
+	Conforme bool     `json:"conforme"`
+	Raisons  []string `json:"raisons,omitempty"` // Raisons de la non-conformité
+}
+
+// Version RouterOS décomposée.
+type RouterOSVersion struct {
+	Numbers    []int  // ex: [7 14 2]
+	PreRelease string // ex: "rc3", "beta2", vide pour une version finale
+	Channel    string // ex: "stable", vide si non précisé
+}
+
+// Décompose une version RouterOS telle que renvoyée par /system/resource (ex: "7.14.2 (stable)", "7.15rc3 (testing)").
+// Prend en entrée la version (string) et renvoie la version décomposée (RouterOSVersion) ou une erreur si elle est illisible.
+func parseRouterOSVersion(s string) (RouterOSVersion, error) {
+
+	var version RouterOSVersion
+
+	// Canal entre parenthèses
+	s = strings.TrimSpace(s)
+	input := s
+	if i := strings.Index(s, "("); i >= 0 {
+		version.Channel = strings.Trim(s[i:], "() ")
+		s = strings.TrimSpace(s[:i])
+	}
+
+	// Suffixe de pré-version (rc, beta...) collé au dernier nombre
+	if i := strings.IndexFunc(s, func(r rune) bool { return r != '.' && (r < '0' || r > '9') }); i >= 0 {
+		version.PreRelease = s[i:]
+		s = s[:i]
+	}
+
+	// Nombres
+	for _, v := range strings.Split(s, ".") {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return version, fmt.Errorf("version illisible: %s", input)
+		}
+		version.Numbers = append(version.Numbers, n)
+	}
+
+	return version, nil
+}
+
+// Compare deux versions.
+// Méthode de RouterOSVersion. Prend en entrée l'autre version (RouterOSVersion) et renvoie -1, 0 ou 1 selon que la version est inférieure, égale ou supérieure.
+// Les nombres manquants valent 0 (7.14 == 7.14.0), et une pré-version est inférieure à la version finale (7.15rc3 < 7.15).
+func (version RouterOSVersion) compare(other RouterOSVersion) int {
+
+	for i := 0; i < len(version.Numbers) || i < len(other.Numbers); i++ {
+		var a, b int
+		if i < len(version.Numbers) {
+			a = version.Numbers[i]
+		}
+		if i < len(other.Numbers) {
+			b = other.Numbers[i]
+		}
+		if a != b {
+			if a < b {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	switch {
+	case version.PreRelease == other.PreRelease:
+		return 0
+	case version.PreRelease == "":
+		return 1
+	case other.PreRelease == "":
+		return -1
+	}
+
+	// Pré-versions: d'abord le type (alpha < beta < rc), puis le numéro (rc3 < rc10)
+	nameA, numA := splitPreRelease(version.PreRelease)
+	nameB, numB := splitPreRelease(other.PreRelease)
+	switch {
+	case nameA != nameB:
+		return strings.Compare(nameA, nameB)
+	case numA < numB:
+		return -1
+	case numA > numB:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Sépare un suffixe de pré-version en type et numéro (ex: "rc3" -> "rc", 3).
+// Prend en entrée le suffixe (string) et renvoie le type (string) et le numéro (int, 0 si absent).
+func splitPreRelease(s string) (string, int) {
+
+	i := strings.IndexAny(s, "0123456789")
+	if i < 0 {
+		return s, 0
+	}
+	n, _ := strconv.Atoi(s[i:])
+
+	return s[:i], n
+}
+
+// Renvoie la version sans le canal (ex: "7.15rc3").
+// Méthode de RouterOSVersion. Ne prend rien en entrée et renvoie la version (string).
+func (version RouterOSVersion) String() string {
+
+	var parts []string
+	for _, n := range version.Numbers {
+		parts = append(parts, strconv.Itoa(n))
+	}
+
+	return strings.Join(parts, ".") + version.PreRelease
+}
+
+// Vérifie la conformité d'un routeur à la politique.
+// Méthode de CompliancePolicy. Prend en entrée les informations RouterOS du routeur (*RouterOSInfo)
+// et renvoie la conformité (*Compliance), ou nil si la politique est vide ou si la version du routeur est inconnue.
+func (policy CompliancePolicy) check(info *RouterOSInfo) *Compliance {
+
+	if len(policy.Channels) == 0 && len(policy.Blocked) == 0 {
+		return nil
+	}
+	if info == nil || info.Version == "" {
+		return nil
+	}
+
+	res := &Compliance{Conforme: true}
+
+	version, err := parseRouterOSVersion(info.Version)
+	if err != nil {
+		res.Conforme = false
+		res.Raisons = append(res.Raisons, err.Error())
+		return res
+	}
+
+	// Versions interdites
+	for _, v := range policy.Blocked {
+		if match, _ := path.Match(v, version.String()); match || v == version.String() {
+			res.Conforme = false
+			res.Raisons = append(res.Raisons, fmt.Sprintf("version %s interdite", version))
+		}
+	}
+
+	// Version minimum du canal
+	if len(policy.Channels) > 0 {
+		min, ok := policy.Channels[version.Channel]
+		if !ok {
+			res.Conforme = false
+			res.Raisons = append(res.Raisons, fmt.Sprintf("canal '%s' non prévu par la politique", version.Channel))
+		} else if minVersion, err := parseRouterOSVersion(min); err != nil {
+			res.Conforme = false
+			res.Raisons = append(res.Raisons, fmt.Sprintf("version minimum du canal %s illisible: %s", version.Channel, min))
+		} else if version.compare(minVersion) < 0 {
+			res.Conforme = false
+			res.Raisons = append(res.Raisons, fmt.Sprintf("version %s inférieure au minimum %s du canal %s", version, min, version.Channel))
+		}
+	}
+
+	return res
+}
+
+// Ligne du rapport de conformité.
+type ComplianceEntry struct {
+	IP         string      `json:"ip"`
+	Identite   string      `json:"identite"`
+	Version    string      `json:"version"`
+	Conformite *Compliance `json:"conformite"` // nil si la version est inconnue
+}
+
+// Rapport de conformité d'un utilisateur Grafana.
+type UserCompliance struct {
+	Username     string            `json:"username"`
+	Total        int               `json:"total"`
+	Conformes    int               `json:"conformes"`
+	NonConformes int               `json:"non_conformes"`
+	Inconnus     int               `json:"inconnus"` // Routeurs dont la version n'est pas connue
+	Routers      []ComplianceEntry `json:"routers"`
+}
+
+// Structure de la réponse de /api/v1/compliance
+type ComplianceReport struct {
+	GenereLe     time.Time        `json:"genere_le"`
+	Politique    CompliancePolicy `json:"politique"`
+	Utilisateurs []UserCompliance `json:"utilisateurs"`
+}
+
+// Construit le rapport de conformité, regroupé par utilisateur Grafana principal (Username).
+// Prend en entrée les routeurs ([]Router) et la politique (CompliancePolicy), renvoie le rapport (ComplianceReport).
+// Les utilisateurs sont triés par nom, et dans chaque utilisateur les routeurs non conformes apparaissent en premier.
+func buildComplianceReport(routers []Router, policy CompliancePolicy) ComplianceReport {
+
+	report := ComplianceReport{GenereLe: time.Now(), Politique: policy, Utilisateurs: []UserCompliance{}}
+	byUser := make(map[string]*UserCompliance)
+
+	for _, v := range routers {
+		entry := ComplianceEntry{IP: v.IP, Conformite: policy.check(v.RouterOS)}
+		if v.RouterOS != nil {
+			entry.Identite, entry.Version = v.RouterOS.Identite, v.RouterOS.Version
+		}
+
+		user, ok := byUser[v.Username]
+		if !ok {
+			user = &UserCompliance{Username: v.Username}
+			byUser[v.Username] = user
+		}
+		user.Total++
+		switch {
+		case entry.Conformite == nil:
+			user.Inconnus++
+		case entry.Conformite.Conforme:
+			user.Conformes++
+		default:
+			user.NonConformes++
+		}
+		user.Routers = append(user.Routers, entry)
+	}
+
+	for _, v := range byUser {
+		sort.SliceStable(v.Routers, func(i, j int) bool {
+			a, b := v.Routers[i].Conformite, v.Routers[j].Conformite
+			return a != nil && !a.Conforme && (b == nil || b.Conforme)
+		})
+		report.Utilisateurs = append(report.Utilisateurs, *v)
+	}
+	sort.Slice(report.Utilisateurs, func(i, j int) bool {
+		return report.Utilisateurs[i].Username < report.Utilisateurs[j].Username
+	})
+
+	return report
+}
+
+// Traite les requêtes HTTP GET sur /api/v1/compliance.
+// Renvoie le rapport de conformité des routeurs visibles par l'utilisateur (paramètre user, admin pour tous les routeurs).
+// Prend en entrée un http.responseWriter et un pointeur *http.Request.
+func getCompliance(writer http.ResponseWriter, request *http.Request) {
+
+	user := request.URL.Query().Get("user")
+	report := buildComplianceReport(visibleRouters(user), getConfig().Compliance)
+
+	writer.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(writer).Encode(report)
+	if err != nil {
+		requestLogger(request).Warn("erreur lors de l'envoi de la réponse", "username", user, "error", err)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRouterOSVersion(t *testing.T) {
+
+	tests := []struct {
+		in   string
+		want RouterOSVersion
+		err  bool
+	}{
+		{"7.14.2 (stable)", RouterOSVersion{Numbers: []int{7, 14, 2}, Channel: "stable"}, false},
+		{"7.15rc3 (testing)", RouterOSVersion{Numbers: []int{7, 15}, PreRelease: "rc3", Channel: "testing"}, false},
+		{"6.49.10 (long-term)", RouterOSVersion{Numbers: []int{6, 49, 10}, Channel: "long-term"}, false},
+		{" 7.16beta2 ", RouterOSVersion{Numbers: []int{7, 16}, PreRelease: "beta2"}, false},
+		{"7", RouterOSVersion{Numbers: []int{7}}, false},
+		{"", RouterOSVersion{}, true},
+		{"7..1", RouterOSVersion{}, true},
+		{"(stable)", RouterOSVersion{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseRouterOSVersion(tt.in)
+		if (err != nil) != tt.err {
+			t.Errorf("parseRouterOSVersion(%q): erreur = %v, attendu erreur = %v", tt.in, err, tt.err)
+			continue
+		}
+		if !tt.err && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseRouterOSVersion(%q) = %+v, attendu %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRouterOSVersionCompare(t *testing.T) {
+
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"7.14.2", "7.14.2", 0},
+		{"7.14", "7.14.0", 0},
+		{"7.14.2", "7.14.10", -1},
+		{"7.15", "7.14.3", 1},
+		{"6.49.10", "7.1", -1},
+		{"7.15rc3", "7.15", -1},
+		{"7.15", "7.15rc3", 1},
+		{"7.15rc3", "7.15rc10", -1},
+		{"7.15beta9", "7.15rc1", -1},
+		{"7.15rc1", "7.14.3", 1},
+		{"7.14.2 (stable)", "7.14.2 (long-term)", 0},
+	}
+
+	for _, tt := range tests {
+		a, _ := parseRouterOSVersion(tt.a)
+		b, _ := parseRouterOSVersion(tt.b)
+		if got := a.compare(b); got != tt.want {
+			t.Errorf("%s comparé à %s = %d, attendu %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := b.compare(a); got != -tt.want {
+			t.Errorf("%s comparé à %s = %d, attendu %d", tt.b, tt.a, got, -tt.want)
+		}
+	}
+}
+
+func TestCompliancePolicyCheck(t *testing.T) {
+
+	policy := CompliancePolicy{
+		Channels: map[string]string{"stable": "7.14.2", "long-term": "6.49.10"},
+		Blocked:  []string{"7.13", "7.12.*"},
+	}
+
+	tests := []struct {
+		version string
+		want    *Compliance
+	}{
+		{"", nil},
+		{"7.14.2 (stable)", &Compliance{Conforme: true}},
+		{"7.15rc3 (stable)", &Compliance{Conforme: true}},
+		{"7.14.1 (stable)", &Compliance{Raisons: []string{"version 7.14.1 inférieure au minimum 7.14.2 du canal stable"}}},
+		{"7.13 (stable)", &Compliance{Raisons: []string{"version 7.13 interdite", "version 7.13 inférieure au minimum 7.14.2 du canal stable"}}},
+		{"7.12.1 (long-term)", &Compliance{Raisons: []string{"version 7.12.1 interdite"}}},
+		{"7.16 (testing)", &Compliance{Raisons: []string{"canal 'testing' non prévu par la politique"}}},
+		{"inconnue", &Compliance{Raisons: []string{"version illisible: inconnue"}}},
+	}
+
+	for _, tt := range tests {
+		got := policy.check(&RouterOSInfo{Version: tt.version})
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("check(%q) = %+v, attendu %+v", tt.version, got, tt.want)
+		}
+	}
+
+	if got := (CompliancePolicy{}).check(&RouterOSInfo{Version: "7.1"}); got != nil {
+		t.Errorf("politique vide: check = %+v, attendu nil", got)
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// Structure mikromap.json (configuration partagée par mikromap-api et mikromap-cli).
+// Le fichier est optionnel: s'il n'existe pas, la configuration par défaut est utilisée.
+type Config struct {
+	Groups     map[string][]string      `json:"groups"` // Nom du groupe -> utilisateurs Grafana membres
+	HTTP       HTTPConfig               `json:"http"`
+	RouterOS   RouterOSConfig           `json:"routeros"`
+	Compliance CompliancePolicy         `json:"compliance"`
+	Backup     BackupConfig             `json:"backup"`
+	Traps      TrapsConfig              `json:"traps"`
+	Syslog     SyslogConfig             `json:"syslog"`
+	SNMP       SNMPConfig               `json:"snmp"`
+	Devices    map[string]DeviceProfile `json:"devices"` // Type d'appareil -> profil, ajouté aux profils par défaut (voir defaultProfiles)
+}
+
+// Profil d'un type d'appareil: fichiers de cibles Prometheus et modules snmp_exporter qui s'appliquent aux appareils de ce type.
+// Les fichiers de cibles sont tenus à jour par mikromap-cli. Pour ajouter un type, déclarer son profil dans mikromap.json
+// et le job correspondant dans prometheus_config.yml.
+type DeviceProfile struct {
+	Targets  []string `json:"targets"`  // Fichiers de cibles Prometheus (dans conf/) où sont déclarés les appareils
+	Modules  []string `json:"modules"`  // Modules snmp_exporter des jobs correspondants
+	RouterOS bool     `json:"routeros"` // Appareil sous RouterOS: interrogé via l'API RouterOS et sauvegardé (si activé)
+}
+
+// Profils par défaut. Le type d'appareil par défaut est mikrotik.
+func defaultProfiles() map[string]DeviceProfile {
+
+	return map[string]DeviceProfile{
+		"mikrotik":   {Targets: []string{"global_targets.json", "mikrotik_targets.json"}, Modules: []string{"global", "mikrotik"}, RouterOS: true},
+		"watchguard": {Targets: []string{"global_targets.json"}, Modules: []string{"global"}},
+		"fortinet":   {Targets: []string{"global_targets.json", "fortinet_targets.json"}, Modules: []string{"global", "fortigate_snmp"}},
+		"snmp":       {Targets: []string{"global_targets.json"}, Modules: []string{"global"}},
+	}
+}
+
+// Configuration du serveur HTTP de mikromap-api.
+// Listen n'est lu qu'au démarrage, le reste est rechargé sur SIGHUP.
+type HTTPConfig struct {
+	Listen string     `json:"listen"` // Adresse d'écoute (défaut: localhost:3333)
+	TLS    TLSConfig  `json:"tls"`
+	Auth   AuthConfig `json:"auth"`
+}
+
+// Configuration HTTPS. Les chemins relatifs sont pris depuis le dossier conf/.
+type TLSConfig struct {
+	Cert     string `json:"cert"`      // Certificat (PEM), HTTPS est activé s'il est renseigné
+	Key      string `json:"key"`       // Clé privée (PEM)
+	ClientCA string `json:"client_ca"` // CA des clients (PEM), la vérification mTLS est activée si elle est renseignée
+}
+
+// Configuration de l'authentification des requêtes HTTP.
+// Si aucun jeton ni utilisateur n'est renseigné, l'API reste ouverte.
+type AuthConfig struct {
+	Tokens []string          `json:"tokens"` // Jetons acceptés dans l'en-tête Authorization: Bearer
+	Basic  map[string]string `json:"basic"`  // Utilisateur -> mot de passe acceptés dans l'en-tête Authorization: Basic
+}
+
+// Configuration de l'interrogation des routeurs via l'API RouterOS (voir routeros.go).
+type RouterOSConfig struct {
+	Enabled  bool                   `json:"enabled"`
+	TLS      bool                   `json:"tls"`      // Utiliser api-ssl (port 8729) au lieu de api (port 8728)
+	Insecure bool                   `json:"insecure"` // Ne pas vérifier le certificat api-ssl (certificats auto-signés des routeurs)
+	Interval Duration               `json:"interval"` // Durée entre deux interrogations (défaut: 10m)
+	Default  Credentials            `json:"default"`  // Identifiants utilisés pour les routeurs absents de Routers
+	Routers  map[string]Credentials `json:"routers"`  // IP du routeur -> identifiants propres
+}
+
+// Configuration des sauvegardes de configuration des routeurs (voir backup.go).
+type BackupConfig struct {
+	Enabled         bool                   `json:"enabled"`
+	Interval        Duration               `json:"interval"`          // Durée entre deux sauvegardes (défaut: 24h)
+	Dir             string                 `json:"dir"`               // Dossier de stockage, relatif au dossier conf/ (défaut: ../backups)
+	Binary          bool                   `json:"binary"`            // Récupérer aussi un fichier .backup (restauration complète sur le même modèle)
+	Keep            int                    `json:"keep"`              // Nombre de versions conservées par routeur (défaut: 30, 0 pour tout garder)
+	MaxAge          Duration               `json:"max_age"`           // Âge maximum des versions conservées (optionnel), la dernière version est toujours gardée
+	KnownHosts      string                 `json:"known_hosts"`       // Fichier known_hosts pour vérifier les clés SSH des routeurs (obligatoire sauf si InsecureHostKey)
+	InsecureHostKey bool                   `json:"insecure_host_key"` // Accepter les clés SSH sans vérification si KnownHosts est vide (déconseillé)
+	Key             string                 `json:"key"`               // Clé privée SSH (optionnelle, utilisée en plus du mot de passe)
+	Default         Credentials            `json:"default"`           // Identifiants SSH utilisés pour les routeurs absents de Routers
+	Routers         map[string]Credentials `json:"routers"`           // IP du routeur -> identifiants SSH propres
+}
+
+// Configuration de la réception des traps SNMP (voir traps.go).
+// Enabled et Listen ne sont lus qu'au démarrage, le reste est rechargé sur SIGHUP.
+type TrapsConfig struct {
+	Enabled     bool     `json:"enabled"`
+	Listen      string   `json:"listen"`      // Adresse d'écoute UDP (défaut: :162), préfixer par tcp:// pour écouter en TCP
+	Communities []string `json:"communities"` // Communautés acceptées (toutes si vide)
+	Buffer      int      `json:"buffer"`      // Nombre de traps conservés en mémoire (défaut: 1000)
+	Alert       []string `json:"alert"`       // Traps qui lèvent une alerte (défaut: linkDown, linkUp, coldStart)
+}
+
+// Configuration de la réception des logs des routeurs (voir syslog.go).
+// Enabled, UDP et TCP ne sont lus qu'au démarrage, Buffer est rechargé sur SIGHUP.
+type SyslogConfig struct {
+	Enabled bool   `json:"enabled"`
+	UDP     string `json:"udp"`    // Adresse d'écoute UDP (défaut: :514, vide pour désactiver)
+	TCP     string `json:"tcp"`    // Adresse d'écoute TCP (optionnelle)
+	Buffer  int    `json:"buffer"` // Nombre de messages conservés en mémoire par routeur (défaut: 500)
+	// Limites de l'écoute TCP, lues au démarrage
+	MaxConnections int      `json:"max_connections"` // Nombre maximum de connexions TCP simultanées (défaut: 100)
+	Timeout        Duration `json:"timeout"`         // Délai maximum de réception d'un message, une connexion inactive plus longtemps est fermée (défaut: 5m)
+}
+
+// Configuration de l'interrogation SNMP des routeurs (voir snmp.go).
+type SNMPConfig struct {
+	Enabled  bool                       `json:"enabled"`
+	Interval Duration                   `json:"interval"` // Durée entre deux interrogations (défaut: 1m)
+	Default  SNMPCredentials            `json:"default"`  // Paramètres utilisés pour les routeurs absents de Routers
+	Routers  map[string]SNMPCredentials `json:"routers"`  // IP du routeur -> paramètres propres
+}
+
+// Paramètres SNMP d'un routeur.
+type SNMPCredentials struct {
+	Version      string `json:"version"`       // 2c (défaut) ou 3
+	Community    string `json:"community"`     // v2c (défaut: public)
+	Port         int    `json:"port"`          // Optionnel, 161 sinon
+	Username     string `json:"username"`      // v3
+	AuthProtocol string `json:"auth_protocol"` // v3: MD5, SHA, SHA256... (vide pour noAuthNoPriv)
+	AuthPassword string `json:"auth_password"` // v3
+	PrivProtocol string `json:"priv_protocol"` // v3: DES, AES... (vide pour authNoPriv)
+	PrivPassword string `json:"priv_password"` // v3
+}
+
+// Identifiants de connexion à un routeur.
+// Un compte en lecture seule suffit (groupe read sur RouterOS).
+type Credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Port     int    `json:"port"` // Optionnel, port par défaut du protocole sinon
+}
+
+// Durée lue depuis une chaîne au format de time.ParseDuration (ex: "10m", "1h30m").
+type Duration time.Duration
+
+// Méthode de *Duration, voir json.Unmarshaler.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+
+	var s string
+
+	err := json.Unmarshal(data, &s)
+	if err != nil {
+		return fmt.Errorf("durée invalide %s: %w", data, err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("durée invalide %s: %w", data, err)
+	}
+	*d = Duration(v)
+
+	return nil
+}
+
+// Renvoie les identifiants à utiliser pour un routeur.
+// Méthode de RouterOSConfig. Prend en entrée l'IP du routeur (string) et renvoie ses identifiants (Credentials), ceux par défaut s'il n'en a pas de propres.
+func (conf RouterOSConfig) credentials(ip string) Credentials {
+
+	if creds, ok := conf.Routers[ip]; ok {
+		return creds
+	}
+	return conf.Default
+}
+
+// Renvoie les identifiants SSH à utiliser pour un routeur.
+// Méthode de BackupConfig. Prend en entrée l'IP du routeur (string) et renvoie ses identifiants (Credentials), ceux par défaut s'il n'en a pas de propres.
+func (conf BackupConfig) credentials(ip string) Credentials {
+
+	if creds, ok := conf.Routers[ip]; ok {
+		return creds
+	}
+	return conf.Default
+}
+
+// Indique si un routeur est sous RouterOS d'après le profil de son type.
+// Méthode de Config. Prend en entrée le routeur (Router) et renvoie un booléen.
+// Le type des routeurs enregistrés sans type est déduit au chargement de l'inventaire (voir inferTypes).
+func (config Config) isRouterOS(router Router) bool {
+
+	return config.Devices[router.Type].RouterOS
+}
+
+// Renvoie les paramètres SNMP à utiliser pour un routeur.
+// Méthode de SNMPConfig. Prend en entrée l'IP du routeur (string) et renvoie ses paramètres (SNMPCredentials), ceux par défaut s'il n'en a pas de propres.
+func (conf SNMPConfig) credentials(ip string) SNMPCredentials {
+
+	if creds, ok := conf.Routers[ip]; ok {
+		return creds
+	}
+	return conf.Default
+}
+
+// Configuration courante de l'API.
+// Chargée au démarrage puis rechargée à chaque SIGHUP (voir reloadConfig).
+var currentConfig atomic.Pointer[Config]
+
+// Récupère la configuration dans mikromap.json.
+// Ne prend rien en entrée et renvoie la configuration (Config) ou une erreur si le fichier est illisible ou invalide.
+func readConfig() (Config, error) {
+
+	var config Config
+	config.HTTP.Listen = "localhost:3333"
+	config.RouterOS.Interval = Duration(time.Minute * 10)
+	config.Backup.Interval = Duration(time.Hour * 24)
+	config.Backup.Dir = "../backups"
+	config.Backup.Keep = 30
+	config.Traps.Listen = ":162"
+	config.Traps.Buffer = 1000
+	config.Traps.Alert = []string{"linkDown", "linkUp", "coldStart"}
+	config.Syslog.UDP = ":514"
+	config.Syslog.Buffer = 500
+	config.Syslog.MaxConnections = 100
+	config.Syslog.Timeout = Duration(time.Minute * 5)
+	config.SNMP.Interval = Duration(time.Minute)
+	config.Devices = defaultProfiles()
+
+	// Lecture du fichier
+	content, err := os.ReadFile(getPath("mikromap.json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return config, nil
+	}
+	if err != nil {
+		return config, fmt.Errorf("erreur lors de la lecture du fichier de configuration: %w", err)
+	}
+
+	// Traitement des données
+	err = json.NewDecoder(bytes.NewBuffer(content)).Decode(&config)
+	if err != nil {
+		return config, fmt.Errorf("erreur lors du traitement des données du fichier de configuration: %w", err)
+	}
+
+	// Validation des valeurs
+	if config.Traps.Buffer < 0 {
+		return config, fmt.Errorf("taille du tampon des traps invalide: %d (traps.buffer doit être positif)", config.Traps.Buffer)
+	}
+	if config.Syslog.Buffer < 0 {
+		return config, fmt.Errorf("taille du tampon syslog invalide: %d (syslog.buffer doit être positif)", config.Syslog.Buffer)
+	}
+	if config.Syslog.Timeout <= 0 {
+		return config, fmt.Errorf("délai syslog invalide: %s (syslog.timeout doit être strictement positif)", time.Duration(config.Syslog.Timeout))
+	}
+
+	return config, nil
+}
+
+// Renvoie le chemin d'un fichier référencé dans la configuration.
+// Prend en entrée le chemin tel qu'écrit dans mikromap.json (string) et le renvoie tel quel s'il est absolu, ou relatif au dossier conf/ sinon.
+func confPath(path string) string {
+
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return getPath(path)
+}
+
+// Recharge la configuration courante depuis mikromap.json.
+// Ne prend rien en entrée et renvoie une erreur si la nouvelle configuration n'a pas pu être lue, auquel cas l'ancienne est conservée.
+func reloadConfig() error {
+
+	config, err := readConfig()
+	if err != nil {
+		return err
+	}
+	currentConfig.Store(&config)
+
+	return nil
+}
+
+// Renvoie la configuration courante.
+// Ne prend rien en entrée et renvoie la configuration (Config).
+func getConfig() Config {
+	return *currentConfig.Load()
+}
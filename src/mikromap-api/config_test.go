@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadConfigValidation(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		content string
+		valid   bool
+	}{
+		{"défauts", `{}`, true},
+		{"tampon des traps vide", `{"traps": {"buffer": 0}}`, true},
+		{"tampon des traps négatif", `{"traps": {"buffer": -1}}`, false},
+		{"tampon syslog négatif", `{"syslog": {"buffer": -1}}`, false},
+		{"délai syslog nul", `{"syslog": {"timeout": "0s"}}`, false},
+		{"délai syslog négatif", `{"syslog": {"timeout": "-1m"}}`, false},
+		{"délai syslog", `{"syslog": {"timeout": "30s"}}`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := tempConf(t)
+			if err := os.WriteFile(filepath.Join(conf, "mikromap.json"), []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := readConfig(); (err == nil) != tt.valid {
+				t.Errorf("readConfig = %v, valide attendu: %v", err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestReloadConfigKeepsPrevious(t *testing.T) {
+
+	conf := tempConf(t)
+	previous := currentConfig.Load()
+	t.Cleanup(func() { currentConfig.Store(previous) })
+
+	config := Config{}
+	config.Traps.Buffer = 42
+	currentConfig.Store(&config)
+
+	if err := os.WriteFile(filepath.Join(conf, "mikromap.json"), []byte(`{"traps": {"buffer": -5}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := reloadConfig(); err == nil {
+		t.Fatal("reloadConfig a accepté un tampon négatif")
+	}
+	if got := getConfig().Traps.Buffer; got != 42 {
+		t.Errorf("traps.buffer = %d après un rechargement refusé, attendu 42", got)
+	}
+}
@@ -1,15 +1,30 @@
 module mikromap-api
 
-go 1.19
+go 1.22
 
 require (
+	github.com/fsnotify/fsnotify v1.7.0
+	github.com/google/uuid v1.6.0
 	github.com/gorilla/mux v1.8.1
+	github.com/gosnmp/gosnmp v1.37.0
+	github.com/leodido/go-syslog/v4 v4.3.0
+	github.com/pborman/getopt/v2 v2.1.0
+	github.com/pkg/sftp v1.13.6
+	github.com/pmezard/go-difflib v1.0.0
 	github.com/prometheus-community/pro-bing v0.4.0
+	github.com/prometheus/client_golang v1.19.0
+	golang.org/x/crypto v0.21.0
+	golang.org/x/net v0.21.0
 )
 
 require (
-	github.com/google/uuid v1.6.0 // indirect
-	golang.org/x/net v0.21.0 // indirect
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cespare/xxhash/v2 v2.2.0 // indirect
+	github.com/kr/fs v0.1.0 // indirect
+	github.com/prometheus/client_model v0.5.0 // indirect
+	github.com/prometheus/common v0.48.0 // indirect
+	github.com/prometheus/procfs v0.12.0 // indirect
 	golang.org/x/sync v0.6.0 // indirect
-	golang.org/x/sys v0.17.0 // indirect
+	golang.org/x/sys v0.18.0 // indirect
+	google.golang.org/protobuf v1.32.0 // indirect
 )
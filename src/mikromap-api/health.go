@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/net/icmp"
+)
+
+// Résultat de la dernière passe de ping, utilisé par /readyz.
+type SweepStats struct {
+	mu       sync.RWMutex
+	start    time.Time
+	end      time.Time
+	duration time.Duration
+	routers  int
+}
+
+// Statistiques globales de la boucle de ping.
+var lastSweep SweepStats
+
+// Enregistre la fin d'une passe de ping.
+// Méthode de *SweepStats. Prend en entrée le début de la passe (time.Time), sa durée (time.Duration) et le nombre de routeurs testés (int), ne renvoie rien.
+func (stats *SweepStats) record(start time.Time, duration time.Duration, routers int) {
+
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+
+	stats.start, stats.end, stats.duration, stats.routers = start, start.Add(duration), duration, routers
+}
+
+// Structure de la réponse de /readyz
+type Readiness struct {
+	Ready           bool              `json:"ready"`
+	Checks          map[string]string `json:"checks"` // Nom de la vérification -> "ok" ou description du problème
+	LastSweep       *time.Time        `json:"last_sweep"`
+	SweepDurationMs int64             `json:"sweep_duration_ms"`
+	Routers         int               `json:"routers"`
+}
+
+// Traite les requêtes HTTP GET sur /healthz.
+// Répond 200 tant que le processus tourne et sert des requêtes.
+// Prend en entrée un http.responseWriter et un pointeur *http.Request.
+func getHealthz(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	writer.Write([]byte("ok\n"))
+}
+
+// Traite les requêtes HTTP GET sur /readyz.
+// L'API est prête si l'inventaire est chargé, si la dernière passe de ping s'est terminée il y a moins de 3 intervalles,
+// et si un socket ICMP peut être ouvert (l'API doit tourner en sudo). Répond 200 si elle est prête, 503 sinon.
+// Le corps détaille chaque vérification et la dernière passe, pour détecter une boucle de ping bloquée.
+// Prend en entrée un http.responseWriter et un pointeur *http.Request.
+func getReadyz(writer http.ResponseWriter, request *http.Request) {
+
+	res := Readiness{Ready: true, Checks: make(map[string]string)}
+
+	// Inventaire
+	inventory.mu.RLock()
+	loaded := inventory.loaded
+	inventory.mu.RUnlock()
+	res.Checks["inventory"] = "ok"
+	if !loaded {
+		res.Checks["inventory"] = "inventaire non chargé"
+	}
+
+	// Dernière passe de ping
+	lastSweep.mu.RLock()
+	end, duration, routers := lastSweep.end, lastSweep.duration, lastSweep.routers
+	lastSweep.mu.RUnlock()
+	res.Checks["sweep"] = "ok"
+	if end.IsZero() {
+		res.Checks["sweep"] = "aucune passe de ping terminée"
+	} else {
+		res.LastSweep = &end
+		res.SweepDurationMs = duration.Milliseconds()
+		res.Routers = routers
+		if time.Since(end) > 3*probeInterval {
+			res.Checks["sweep"] = "dernière passe de ping terminée il y a " + time.Since(end).Round(time.Second).String()
+		}
+	}
+
+	// Socket ICMP
+	res.Checks["icmp"] = "ok"
+	conn, err := icmp.ListenPacket("ip4:icmp", "0.0.0.0")
+	if err != nil {
+		res.Checks["icmp"] = err.Error()
+	} else {
+		conn.Close()
+	}
+
+	// Résultat
+	for _, v := range res.Checks {
+		if v != "ok" {
+			res.Ready = false
+		}
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	if !res.Ready {
+		writer.WriteHeader(http.StatusServiceUnavailable)
+	}
+	err = json.NewEncoder(writer).Encode(res)
+	if err != nil {
+		requestLogger(request).Warn("erreur lors de l'envoi de la réponse", "error", err)
+	}
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Inventaire des routeurs en mémoire.
+// Contient le dernier routers.json valide, complété par les résultats de la dernière passe de ping.
+// Les requêtes HTTP et la boucle de ping lisent cet inventaire au lieu de relire le fichier à chaque fois.
+type Inventory struct {
+	mu      sync.RWMutex
+	routers []Router
+	sources map[string]int // Adresse IP normalisée (IP ou adresse résolue) -> indice du routeur, voir routerBySource
+	hash    [32]byte       // Empreinte du dernier contenu lu ou écrit, pour ignorer nos propres écritures
+	loaded  bool
+}
+
+// Inventaire global de l'API.
+var inventory Inventory
+
+// Vérifie qu'un inventaire peut être utilisé.
+// Prend en entrée les routeurs ([]Router) et renvoie une erreur décrivant le premier problème trouvé (IP vide ou en double, coordonnées hors limites).
+func validateInventory(routers []Router) error {
+
+	seen := make(map[string]bool)
+
+	for i, v := range routers {
+		if v.IP == "" {
+			return fmt.Errorf("routeur n°%d sans IP", i+1)
+		}
+		if seen[v.IP] {
+			return fmt.Errorf("IP %s présente plusieurs fois", v.IP)
+		}
+		seen[v.IP] = true
+		if v.Lat < -90 || v.Lat > 90 || v.Lon < -180 || v.Lon > 180 {
+			return fmt.Errorf("coordonnées invalides pour %s (%f, %f)", v.IP, v.Lat, v.Lon)
+		}
+	}
+
+	return nil
+}
+
+// Charge routers.json dans l'inventaire.
+// Méthode de *Inventory. Ne prend rien en entrée et renvoie une erreur si le fichier est illisible ou invalide, auquel cas l'inventaire courant est conservé.
+// Les statuts déjà connus en mémoire sont conservés pour les routeurs toujours présents.
+func (inv *Inventory) load() error {
+
+	routers, hash, err := readJSON()
+	if err != nil {
+		return err
+	}
+
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	// Contenu identique (ex: notre propre écriture), rien à faire
+	if inv.loaded && hash == inv.hash {
+		return nil
+	}
+
+	err = validateInventory(routers)
+	if err != nil {
+		return err
+	}
+	err = inferTypes(routers)
+	if err != nil {
+		return err
+	}
+
+	// Report des résultats de ping connus
+	known := make(map[string]Router)
+	for _, v := range inv.routers {
+		known[v.IP] = v
+	}
+	for i, v := range routers {
+		if old, ok := known[v.IP]; ok {
+			routers[i].Statut, routers[i].RTT, routers[i].Resolu, routers[i].Cause = old.Statut, old.RTT, old.Resolu, old.Cause
+			routers[i].RouterOS = old.RouterOS
+		}
+	}
+
+	inv.routers, inv.hash, inv.loaded = routers, hash, true
+	inv.index()
+	logger.Info("inventaire chargé", "routers", len(routers))
+
+	return nil
+}
+
+// Déduit le type des routeurs enregistrés avant l'ajout du champ, comme mikromap-cli:
+// mikrotik s'ils sont déclarés dans mikrotik_targets.json, watchguard sinon (anciennes IP préfixées par "W").
+// Prend en entrée les routeurs ([]Router, complétés) et renvoie une erreur si mikrotik_targets.json est illisible.
+// Le fichier n'est lu que si au moins un routeur n'a pas de type.
+func inferTypes(routers []Router) error {
+
+	var targets map[string]bool
+	for i, v := range routers {
+		if v.Type != "" {
+			continue
+		}
+		if targets == nil {
+			var err error
+			targets, err = readTargets("mikrotik_targets.json")
+			if err != nil {
+				return err
+			}
+		}
+		routers[i].Type = "watchguard"
+		if targets[v.IP] || targets["["+v.IP+"]"] {
+			routers[i].Type = "mikrotik"
+		}
+	}
+
+	return nil
+}
+
+// Lit les cibles d'un fichier de cibles Prometheus de conf/.
+// Prend en entrée le nom du fichier (string) et renvoie les cibles (map cible -> true, vide si le fichier n'existe pas) ou une erreur si le fichier est illisible.
+func readTargets(name string) (map[string]bool, error) {
+
+	res := make(map[string]bool)
+
+	content, err := os.ReadFile(getPath(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return res, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("erreur lors de la lecture de %s: %w", name, err)
+	}
+
+	var data []struct {
+		Targets []string `json:"targets"`
+	}
+	err = json.Unmarshal(content, &data)
+	if err != nil {
+		return nil, fmt.Errorf("erreur lors du traitement des données de %s: %w", name, err)
+	}
+	for _, v := range data {
+		for _, target := range v.Targets {
+			res[target] = true
+		}
+	}
+
+	return res, nil
+}
+
+// Renvoie une copie de l'inventaire.
+// Méthode de *Inventory. Ne prend rien en entrée et renvoie les routeurs ([]Router), que l'appelant peut modifier librement.
+func (inv *Inventory) snapshot() []Router {
+
+	inv.mu.RLock()
+	defer inv.mu.RUnlock()
+
+	res := make([]Router, len(inv.routers))
+	copy(res, inv.routers)
+
+	return res
+}
+
+// Enregistre les résultats d'une passe de ping dans l'inventaire et dans routers.json.
+// Méthode de *Inventory. Prend en entrée les routeurs testés ([]Router) et ne renvoie rien.
+// L'inventaire a pu être rechargé pendant la passe: seuls les routeurs toujours présents sont mis à jour.
+// Si routers.json a été modifié depuis le dernier chargement (rechargement pas encore traité ou fichier invalide), il n'est pas écrasé.
+func (inv *Inventory) update(probed []Router) {
+
+	results := make(map[string]Router)
+	for _, v := range probed {
+		results[v.IP] = v
+	}
+
+	// Verrou partagé avec mikromap-cli, qui ne doit pas remplacer le fichier entre la vérification et l'écriture.
+	// Pris avant inv.mu pour ne pas bloquer les lectures de l'inventaire pendant l'attente.
+	unlock, lockErr := lockRouters()
+	if lockErr != nil {
+		logger.Error("erreur lors de l'enregistrement des statuts", "file", getPath("routers.json"), "error", lockErr)
+	} else {
+		defer unlock()
+	}
+
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	// Mise à jour en mémoire
+	for i, v := range inv.routers {
+		if res, ok := results[v.IP]; ok {
+			inv.routers[i].Statut, inv.routers[i].RTT, inv.routers[i].Resolu, inv.routers[i].Cause = res.Statut, res.RTT, res.Resolu, res.Cause
+		}
+	}
+	inv.index()
+	if lockErr != nil {
+		return
+	}
+
+	// Vérification que le fichier n'a pas changé
+	content, err := os.ReadFile(getPath("routers.json"))
+	if err != nil || sha256.Sum256(content) != inv.hash {
+		logger.Debug("routers.json modifié depuis le dernier chargement, écriture des statuts reportée", "file", getPath("routers.json"))
+		return
+	}
+
+	// Ecriture du fichier
+	hash, err := writeJSON(inv.routers)
+	if err != nil {
+		logger.Error("erreur lors de l'enregistrement des statuts", "file", getPath("routers.json"), "error", err)
+		return
+	}
+	inv.hash = hash
+}
+
+// Verrou de conf/ partagé avec mikromap-cli, qui le prend pendant le remplacement de ses fichiers.
+const routersLock = ".routers.lock"
+
+// Prend le verrou de routers.json partagé avec mikromap-cli.
+// Ne prend rien en entrée et renvoie la fonction qui le libère (func()) ou une erreur. Attend tant que mikromap-cli écrit le fichier.
+func lockRouters() (func(), error) {
+
+	// Ouvert en lecture seule, suffisant pour flock: le fichier reste utilisable par mikromap-cli s'il est créé ici en sudo
+	file, err := os.OpenFile(getPath(routersLock), os.O_RDONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("erreur lors de l'ouverture du verrou %s: %w", getPath(routersLock), err)
+	}
+	err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("erreur lors du verrouillage de %s: %w", getPath(routersLock), err)
+	}
+
+	// La fermeture du fichier libère le verrou
+	return func() { file.Close() }, nil
+}
+
+// Reconstruit l'index des adresses IP des routeurs (IP et adresse résolue lors du dernier ping).
+// Méthode de *Inventory. Ne prend rien en entrée et ne renvoie rien, à appeler verrou pris après chaque modification des routeurs.
+// En cas de doublon, le premier routeur de l'inventaire l'emporte.
+func (inv *Inventory) index() {
+
+	inv.sources = make(map[string]int, len(inv.routers))
+	for i, v := range inv.routers {
+		for _, target := range []string{v.IP, v.Resolu} {
+			if ip := net.ParseIP(target); ip != nil {
+				if _, ok := inv.sources[ip.String()]; !ok {
+					inv.sources[ip.String()] = i
+				}
+			}
+		}
+	}
+}
+
+// Retrouve le routeur correspondant à une adresse source (traps SNMP, syslog).
+// Méthode de *Inventory. Prend en entrée l'adresse (string) et renvoie le routeur (Router) et true s'il a été trouvé dans l'inventaire.
+// L'adresse est comparée à l'IP des routeurs et à l'adresse résolue lors du dernier ping (routeurs déclarés par nom DNS).
+func (inv *Inventory) routerBySource(addr string) (Router, bool) {
+
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return Router{}, false
+	}
+
+	inv.mu.RLock()
+	defer inv.mu.RUnlock()
+
+	i, ok := inv.sources[ip.String()]
+	if !ok {
+		return Router{}, false
+	}
+
+	return inv.routers[i], true
+}
+
+// Modifie un routeur de l'inventaire en mémoire.
+// Méthode de *Inventory. Prend en entrée l'IP du routeur (string) et la fonction de modification (func(*Router)), ne renvoie rien.
+// Ne fait rien si le routeur n'est plus dans l'inventaire. La modification est écrite dans routers.json à la passe de ping suivante.
+func (inv *Inventory) updateRouter(ip string, modify func(*Router)) {
+
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	for i := range inv.routers {
+		if inv.routers[i].IP == ip {
+			modify(&inv.routers[i])
+			return
+		}
+	}
+}
+
+// Surveille routers.json et recharge l'inventaire à chaque modification.
+// Prend en entrée un contexte (context.Context) dont l'annulation arrête la surveillance, et ne renvoie rien.
+// C'est le dossier qui est surveillé et pas le fichier, pour suivre les éditeurs qui remplacent le fichier au lieu de l'écrire.
+// Les événements rapprochés sont regroupés pour ne recharger qu'une fois le fichier complètement écrit.
+func watchInventory(ctx context.Context) {
+
+	path := filepath.Clean(getPath("routers.json"))
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		logger.Error("surveillance de routers.json impossible, utiliser SIGHUP pour recharger l'inventaire", "error", err)
+		return
+	}
+	defer watcher.Close()
+
+	err = watcher.Add(filepath.Dir(path))
+	if err != nil {
+		logger.Error("surveillance de routers.json impossible, utiliser SIGHUP pour recharger l'inventaire", "error", err)
+		return
+	}
+
+	// Délai de regroupement des événements
+	debounce := time.NewTimer(time.Hour)
+	debounce.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if filepath.Clean(event.Name) == path && event.Has(fsnotify.Write|fsnotify.Create|fsnotify.Rename) {
+				debounce.Reset(time.Millisecond * 250)
+			}
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			logger.Warn("erreur de surveillance de routers.json", "error", err)
+
+		case <-debounce.C:
+			err := inventory.load()
+			if err != nil {
+				logger.Error("inventaire invalide, le dernier inventaire valide est conservé", "file", path, "error", err)
+			}
+		}
+	}
+}
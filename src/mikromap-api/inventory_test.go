@@ -0,0 +1,150 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRouterBySource(t *testing.T) {
+
+	inv := Inventory{routers: []Router{
+		{IP: "10.0.0.1"},
+		{IP: "site.exemple.fr", Resolu: "10.0.0.2"},
+		{IP: "2001:db8::1"},
+		{IP: "routeur.exemple.fr", Resolu: "10.0.0.1"}, // Même adresse que le premier routeur
+		{IP: "sans-resolution.exemple.fr"},
+	}}
+	inv.index()
+
+	tests := []struct {
+		addr string
+		ip   string // IP du routeur attendu, vide si aucun
+	}{
+		{"10.0.0.1", "10.0.0.1"},
+		{"10.0.0.2", "site.exemple.fr"},
+		{"::ffff:10.0.0.2", "site.exemple.fr"},
+		{"2001:0db8:0000::0001", "2001:db8::1"},
+		{"10.0.0.3", ""},
+		{"site.exemple.fr", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		router, ok := inv.routerBySource(tt.addr)
+		if ok != (tt.ip != "") || router.IP != tt.ip {
+			t.Errorf("routerBySource(%q) = %q, %v, attendu %q", tt.addr, router.IP, ok, tt.ip)
+		}
+	}
+}
+
+// Crée un dossier conf/ temporaire et y fait pointer getPath.
+// Prend en entrée le test (*testing.T) et renvoie le chemin du dossier (string).
+func tempConf(t *testing.T) string {
+
+	dir := t.TempDir()
+	t.Setenv("SUDO_USER", ".."+dir)
+	conf := filepath.Dir(getPath("routers.json"))
+	if err := os.MkdirAll(conf, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	return conf
+}
+
+func TestInferTypes(t *testing.T) {
+
+	conf := tempConf(t)
+	targets := `[{"labels": {"job": "mikrotik"}, "targets": ["10.0.0.1", "[2001:db8::1]", "site.exemple.fr"]}]`
+	if err := os.WriteFile(filepath.Join(conf, "mikrotik_targets.json"), []byte(targets), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	routers := []Router{
+		{IP: "10.0.0.1"},
+		{IP: "2001:db8::1"},
+		{IP: "site.exemple.fr"},
+		{IP: "10.0.0.2"}, // Ancien Watchguard (IP préfixée par "W")
+		{IP: "10.0.0.3", Type: "fortinet"},
+		{IP: "10.0.0.4", Type: "mikrotik"},
+	}
+	if err := inferTypes(routers); err != nil {
+		t.Fatal(err)
+	}
+
+	config := Config{Devices: defaultProfiles()}
+	want := []struct {
+		typ      string
+		routerOS bool
+	}{
+		{"mikrotik", true},
+		{"mikrotik", true},
+		{"mikrotik", true},
+		{"watchguard", false},
+		{"fortinet", false},
+		{"mikrotik", true},
+	}
+	for i, v := range routers {
+		if v.Type != want[i].typ || config.isRouterOS(v) != want[i].routerOS {
+			t.Errorf("%s: type %q, RouterOS %v, attendu %q, %v", v.IP, v.Type, config.isRouterOS(v), want[i].typ, want[i].routerOS)
+		}
+	}
+
+	// Sans mikrotik_targets.json, les routeurs sans type sont des Watchguard
+	os.Remove(filepath.Join(conf, "mikrotik_targets.json"))
+	routers = []Router{{IP: "10.0.0.1"}}
+	if err := inferTypes(routers); err != nil || routers[0].Type != "watchguard" {
+		t.Errorf("sans fichier de cibles: type %q, erreur %v", routers[0].Type, err)
+	}
+
+	// Fichier illisible: l'inventaire n'est pas chargé plutôt que mal classé
+	os.WriteFile(filepath.Join(conf, "mikrotik_targets.json"), []byte("{"), 0644)
+	if err := inferTypes([]Router{{IP: "10.0.0.1"}}); err == nil {
+		t.Error("fichier de cibles illisible: erreur attendue")
+	}
+}
+
+func TestUpdateWaitsForLock(t *testing.T) {
+
+	conf := tempConf(t)
+	path := filepath.Join(conf, "routers.json")
+	if err := os.WriteFile(path, []byte(`[{"ip": "10.0.0.1", "type": "mikrotik"}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	inv := &Inventory{}
+	if err := inv.load(); err != nil {
+		t.Fatal(err)
+	}
+
+	// mikromap-cli remplace routers.json pendant la passe de ping
+	unlock, err := lockRouters()
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		inv.update([]Router{{IP: "10.0.0.1", Statut: 1}})
+		close(done)
+	}()
+	select {
+	case <-done:
+		unlock()
+		t.Fatal("update n'a pas attendu le verrou")
+	case <-time.After(100 * time.Millisecond):
+	}
+	cli := `[{"ip": "10.0.0.1", "type": "mikrotik"}, {"ip": "10.0.0.2", "type": "mikrotik"}]`
+	if err := os.WriteFile(path, []byte(cli), 0644); err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+	<-done
+
+	// L'écriture de mikromap-cli n'est pas écrasée, le statut reste en mémoire
+	if content, _ := os.ReadFile(path); string(content) != cli {
+		t.Errorf("routers.json écrasé: %s", content)
+	}
+	if got := inv.snapshot(); got[0].Statut != 1 {
+		t.Errorf("statut en mémoire = %d, attendu 1", got[0].Statut)
+	}
+}
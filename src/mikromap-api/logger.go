@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Logger structuré global.
+// Configuré par setupLogger() selon les flags --log-level et --log-format, écrit sur la sortie d'erreur.
+var logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+// Configure le logger global.
+// Prend en entrée le niveau minimum (string: debug, info, warn ou error) et le format (string: json ou logfmt).
+// Renvoie une erreur si le niveau ou le format est inconnu.
+// Les messages du package log (dépendances) sont redirigés vers ce logger.
+func setupLogger(level string, format string) error {
+
+	var lvl slog.Level
+	var handler slog.Handler
+
+	// Niveau
+	err := lvl.UnmarshalText([]byte(level))
+	if err != nil {
+		return fmt.Errorf("niveau de log inconnu: %s", level)
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	// Format
+	switch strings.ToLower(format) {
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	case "logfmt", "text":
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	default:
+		return fmt.Errorf("format de log inconnu: %s", format)
+	}
+
+	logger = slog.New(handler)
+	slog.SetDefault(logger)
+
+	return nil
+}
+
+// Renvoie un logger qui inclut les champs identifiant un routeur (ip et username).
+// Prend en entrée le routeur (Router) et renvoie le logger (*slog.Logger).
+func routerLogger(router Router) *slog.Logger {
+	return logger.With("ip", router.IP, "username", router.Username)
+}
+
+// Journalise une erreur et arrête le programme (équivalent de log.Fatalf).
+// Prend en entrée le message (string) et les champs à ajouter (paires clé/valeur), ne revient pas.
+func fatal(msg string, args ...any) {
+	logger.Error(msg, args...)
+	os.Exit(1)
+}
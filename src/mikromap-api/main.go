@@ -2,77 +2,149 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	_ "embed"
 	"encoding/json"
 	"fmt"
-	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/pborman/getopt/v2"
 	probing "github.com/prometheus-community/pro-bing"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 // Structure routers.json
 type Router struct {
-	IP       string  `json:"ip"`
-	Lat      float64 `json:"lat"`
-	Lon      float64 `json:"lon"`
-	Adresse  string  `json:"adresse"`
-	Username string  `json:"username"`
-	Statut   int     `json:"statut"`
-	RTT      float64 `json:"rtt"`
-	Visible  bool    `json:"visible"`
+	IP       string   `json:"ip"`
+	Type     string   `json:"type,omitempty"` // Type d'appareil, profil défini dans mikromap.json (voir DeviceProfile)
+	Lat      float64  `json:"lat"`
+	Lon      float64  `json:"lon"`
+	Adresse  string   `json:"adresse"`
+	Username string   `json:"username"`
+	Statut   int      `json:"statut"`
+	RTT      float64  `json:"rtt"`
+	Visible  bool     `json:"visible"`
+	Users    []string `json:"users,omitempty"`  // Utilisateurs Grafana supplémentaires ayant accès au routeur
+	Groups   []string `json:"groups,omitempty"` // Groupes (définis dans mikromap.json) ayant accès au routeur
+	Resolu   string   `json:"resolu,omitempty"` // Adresse utilisée lors du dernier ping (utile quand IP est un nom DNS)
+	Parent   string   `json:"parent,omitempty"` // IP du routeur à travers lequel celui-ci est joignable (optionnel)
+	Manual   bool     `json:"manual,omitempty"` // Coordonnées saisies à la main (mikromap-cli regeocode ne les modifie pas)
+	Cause    string   `json:"cause,omitempty"`  // IP de l'ancêtre down responsable du statut injoignable
+
+	RouterOS   *RouterOSInfo `json:"routeros,omitempty"`   // Renseigné si l'interrogation RouterOS est activée (voir routeros.go)
+	Conformite *Compliance   `json:"conformite,omitempty"` // Calculé à chaque requête selon la politique de versions (voir compliance.go), jamais enregistré
 }
 
-// Renvoie le chemin vers le fichier JSON.
-// Ne prend rien en entrée et renvoie le chemin (string).
-// A modifier si besoin de mettre le fichier ailleurs que dans conf/.
-func getPath() string {
+// Renvoie le chemin vers le fichier JSON spécifié.
+// Prend le nom du fichier en entrée et renvoie le chemin (string).
+// A modifier si besoin de mettre les fichiers ailleurs que dans conf/.
+func getPath(target string) string {
 
-	filePath := fmt.Sprintf("/home/%s/mikrotik-grafana/conf/routers.json", os.Getenv("SUDO_USER"))
+	filePath := fmt.Sprintf("/home/%s/mikrotik-grafana/conf/%s", os.Getenv("SUDO_USER"), target)
 	return filePath
 }
 
 // Récupère les données du fichier de stockage JSON.
-// Ne prend rien en entrée et renvoie les données dans un struct []Router.
-func readJSON() []Router {
+// Ne prend rien en entrée et renvoie les données dans un struct []Router, l'empreinte SHA-256 du contenu lu ([32]byte) et une éventuelle erreur.
+func readJSON() ([]Router, [32]byte, error) {
 
 	var data []Router
 
 	// Lecture du fichier
-	content, err := os.ReadFile(getPath())
+	content, err := os.ReadFile(getPath("routers.json"))
 	if err != nil {
-		log.Fatalf("--- Erreur lors de la lecture du fichier JSON (vérifier que l'exécutable a bien été lancé en sudo):\n%s", err)
+		return nil, [32]byte{}, fmt.Errorf("erreur lors de la lecture du fichier JSON (vérifier que l'exécutable a bien été lancé en sudo): %w", err)
 	}
+	hash := sha256.Sum256(content)
 
 	// Traitement des données
 	err = json.NewDecoder(bytes.NewBuffer(content)).Decode(&data)
 	if err != nil {
-		log.Fatalf("--- Erreur lors du traitement des données du fichier JSON:\n%s", err)
+		return nil, hash, fmt.Errorf("erreur lors du traitement des données du fichier JSON: %w", err)
 	}
 
-	return data
+	return data, hash, nil
 }
 
 // Ecrit par-dessus le fichier JSON.
-// Prend en entrée les données à écrire et ne renvoie rien.
-func writeJSON(data []Router) {
+// Prend en entrée les données à écrire et renvoie l'empreinte SHA-256 du contenu écrit ([32]byte) et une éventuelle erreur.
+// L'écriture passe par un fichier temporaire renommé à la fin, pour qu'un arrêt en cours d'écriture ne laisse jamais un fichier tronqué.
+func writeJSON(data []Router) ([32]byte, error) {
 
-	// Ouverture du fichier
-	content, err := os.OpenFile(getPath(), os.O_WRONLY, os.ModePerm)
+	path := getPath("routers.json")
+
+	// Mise en forme des données
+	content, err := json.MarshalIndent(data, "", "    ")
+	if err != nil {
+		return [32]byte{}, fmt.Errorf("erreur lors de l'écriture du fichier JSON: %w", err)
+	}
+	content = append(content, '\n')
+
+	// Création du fichier temporaire dans le même dossier (le renommage doit rester sur le même système de fichiers)
+	file, err := os.CreateTemp(filepath.Dir(path), ".routers.json.*")
 	if err != nil {
-		log.Fatalf("--- Erreur lors de l'ouverture du fichier JSON pour écriture:\n%s", err)
+		return [32]byte{}, fmt.Errorf("erreur lors de l'ouverture du fichier JSON pour écriture: %w", err)
 	}
+	defer os.Remove(file.Name())
 
 	// Ecriture du fichier
-	enc := json.NewEncoder(content)
-	enc.SetIndent("", "    ")
-	err = enc.Encode(data)
+	_, err = file.Write(content)
+	if err == nil {
+		err = file.Close()
+	}
+	if err != nil {
+		return [32]byte{}, fmt.Errorf("erreur lors de l'écriture du fichier JSON: %w", err)
+	}
+
+	// L'API tourne en sudo: on conserve le propriétaire et les droits d'origine pour que mikromap-cli puisse toujours modifier le fichier.
+	info, err := os.Stat(path)
+	if err == nil {
+		os.Chmod(file.Name(), info.Mode().Perm())
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+			os.Chown(file.Name(), int(stat.Uid), int(stat.Gid))
+		}
+	}
+
+	// Remplacement du fichier
+	err = os.Rename(file.Name(), path)
 	if err != nil {
-		log.Fatalf("--- Erreur lors de l'écriture du fichier JSON:\n%s", err)
+		return [32]byte{}, fmt.Errorf("erreur lors de l'écriture du fichier JSON: %w", err)
+	}
+
+	return sha256.Sum256(content), nil
+}
+
+// Indique si un utilisateur Grafana a accès à un routeur.
+// Méthode de Router. Prend en entrée le nom d'utilisateur (string) et les groupes de la configuration (map nom -> membres),
+// renvoie true si l'utilisateur est le Username du routeur, fait partie de ses Users, ou est membre d'un de ses Groups.
+// Les comparaisons ne tiennent pas compte de la casse, comme les logins Grafana.
+func (router Router) visibleBy(user string, groups map[string][]string) bool {
+
+	if user == "" {
+		return false
+	}
+
+	allowed := append([]string{router.Username}, router.Users...)
+	for _, g := range router.Groups {
+		allowed = append(allowed, groups[g]...)
 	}
+
+	for _, v := range allowed {
+		if strings.EqualFold(v, user) {
+			return true
+		}
+	}
+
+	return false
 }
 
 // Traite les requêtes HTTP GET.
@@ -84,51 +156,180 @@ func getMikromap(writer http.ResponseWriter, request *http.Request) {
 	// Récupération du nom d'utilisateur transmis par Grafana
 	user := request.URL.Query().Get("user")
 
-	fmt.Printf("\033[32mRequête GET entrante sur /mikromap (user = %s)\033[0m\n", user)
+	// Récupération des routeurs visibles, avec leur conformité à la politique de versions
+	dataRouters := visibleRouters(user)
+	policy := getConfig().Compliance
+	for i := range dataRouters {
+		dataRouters[i].Conformite = policy.check(dataRouters[i].RouterOS)
+	}
+
+	// Envoi du struct modifié
+	writer.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(writer).Encode(dataRouters)
+	if err != nil {
+		requestLogger(request).Warn("erreur lors de l'envoi de la réponse", "username", user, "error", err)
+	}
+}
+
+// Renvoie les routeurs de l'inventaire auxquels un utilisateur Grafana a accès (voir visibleBy).
+// Prend en entrée le nom d'utilisateur (string) et renvoie une copie des routeurs visibles ([]Router).
+// Si l'utilisateur vaut admin, tous les routeurs sont renvoyés.
+func visibleRouters(user string) []Router {
 
-	// Récupération routers.json dans un struct
-	dataRouters := readJSON()
+	// Récupération de l'inventaire en mémoire et de la configuration
+	dataRouters := inventory.snapshot()
+	config := getConfig()
 
-	// Suppression dans le struct de tous les routeurs dont le Username n'est pas identique au paramètre reçu.
-	// Si le paramètre reçu vaut admin, on saute cette étape pour renvoyer tous les routeurs.
+	// Suppression dans le struct de tous les routeurs auxquels l'utilisateur n'a pas accès.
 	if user != "admin" {
 		// On parcourt le slice dans le sens inverse pour ne pas modifier des éléments pas encore parcourus.
 		for i := len(dataRouters) - 1; i >= 0; i-- {
 			v := dataRouters[i]
-			if !(strings.EqualFold(v.Username, user)) {
+			if !v.visibleBy(user, config.Groups) {
 				dataRouters = append(dataRouters[0:i], dataRouters[i+1:]...)
 			}
 		}
 	}
 
-	// Envoi du struct modifié
-	json.NewEncoder(writer).Encode(dataRouters)
+	return dataRouters
+}
+
+// Spécification OpenAPI 3 de l'API, à mettre à jour à chaque ajout ou modification de route.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// Traite les requêtes HTTP GET sur /api/v1/openapi.json.
+// Renvoie la spécification OpenAPI de l'API.
+// Prend en entrée un http.responseWriter et un pointeur *http.Request.
+func getOpenAPI(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.Write(openAPISpec)
 }
 
 // Traite les requêtes HTTP entrantes.
-// Ne prend rien en entrée et en renvoie rien.
-// Fonction sans condition de sortie.
-func handleRequests() {
+// Prend en entrée un contexte (context.Context) dont l'annulation déclenche l'arrêt du serveur, et ne renvoie rien.
+// A l'arrêt, les requêtes en cours ont jusqu'à 10 secondes pour se terminer.
+// Chaque requête est journalisée par le middleware accessLog, puis authentifiée par authenticate si l'authentification est configurée
+// (sauf les sondes /healthz et /readyz).
+// Le serveur passe en HTTPS si un certificat est configuré (voir CertStore).
+func handleRequests(ctx context.Context) {
+
+	conf := getConfig().HTTP
 
 	router := mux.NewRouter().StrictSlash(true)
-	router.HandleFunc("/mikromap", getMikromap)
+	router.Use(accessLog)
+
+	// Sondes de santé et documentation, sans authentification
+	router.HandleFunc("/healthz", getHealthz).Methods(http.MethodGet)
+	router.HandleFunc("/readyz", getReadyz).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/openapi.json", getOpenAPI).Methods(http.MethodGet)
+
+	// Routes authentifiées, décrites dans openapi.json
+	api := router.PathPrefix("/").Subrouter()
+	api.Use(authenticate)
+	api.HandleFunc("/api/v1/mikromap", getMikromap).Methods(http.MethodGet)
+	api.HandleFunc("/mikromap", getMikromap).Methods(http.MethodGet) // Alias historique (dashboards existants)
+	api.HandleFunc("/api/v1/compliance", getCompliance).Methods(http.MethodGet)
+	api.HandleFunc("/api/v1/traps", getTraps).Methods(http.MethodGet)
+	api.Handle("/metrics", promhttp.Handler()).Methods(http.MethodGet)
+	api.HandleFunc("/api/v1/routers/{ip}/logs", getLogs).Methods(http.MethodGet)
+	api.HandleFunc("/api/v1/routers/{ip}/backups", getBackups).Methods(http.MethodGet)
+	api.HandleFunc("/api/v1/routers/{ip}/backups/diff", getBackupDiff).Methods(http.MethodGet)
+	api.HandleFunc("/api/v1/routers/{ip}/backups/{version:[0-9]{8}-[0-9]{6}}.{ext:rsc|backup}", getBackupFile).Methods(http.MethodGet)
+
+	server := &http.Server{
+		Addr:    conf.Listen,
+		Handler: router,
+	}
+
+	// Chargement des certificats
+	if conf.TLS.Cert != "" {
+		err := certs.load(conf.TLS)
+		if err != nil {
+			fatal("configuration TLS invalide", "error", err)
+		}
+		server.TLSConfig = certs.tlsConfig()
+	}
+
+	// Ecoute dans une goroutine pour pouvoir attendre le signal d'arrêt
+	go func() {
+		var err error
+		logger.Info("écoute HTTP", "addr", server.Addr, "tls", server.TLSConfig != nil, "mtls", conf.TLS.ClientCA != "")
+		if server.TLSConfig != nil {
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			fatal("arrêt du serveur HTTP", "error", err)
+		}
+	}()
+
+	<-ctx.Done()
+
+	// Arrêt propre: plus de nouvelles connexions, on attend la fin des requêtes en cours.
+	logger.Info("arrêt du serveur HTTP")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	err := server.Shutdown(shutdownCtx)
+	if err != nil {
+		logger.Warn("arrêt forcé du serveur HTTP", "error", err)
+	}
+}
+
+// Résout la cible d'un routeur en adresse IP.
+// Prend en entrée une cible (string: IPv4, IPv6 ou nom DNS) et renvoie l'adresse (net.IP) ou une erreur.
+// Les noms DNS sont résolus à chaque appel pour suivre les changements d'adresse (IP dynamique, DNS dynamique...).
+// Si un nom renvoie plusieurs adresses, on privilégie l'IPv4.
+func resolveTarget(target string) (net.IP, error) {
 
-	log.Fatal(http.ListenAndServe("localhost:3333", router))
+	// Adresse IP littérale (les crochets d'une IPv6 sont tolérés)
+	if ip := net.ParseIP(strings.Trim(target, "[]")); ip != nil {
+		return ip, nil
+	}
+
+	// Nom DNS
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("aucune adresse pour %s", target)
+	}
+	for _, v := range addrs {
+		if v.IP.To4() != nil {
+			return v.IP, nil
+		}
+	}
+	return addrs[0].IP, nil
 }
 
-// Ping une adresse IP pour vérifier son état.
+// Ping une cible pour vérifier son état.
 // Utilisé par Grafana pour déterminer la couleur du point à afficher.
-// Prend en entrée un adresse IP (string) et renvoie le statut (int, up = 1 et down = 0) et le dernier Round Trip Time (float64, milliisecondes).
-// Statut est un int et pas un bool au cas où il y aurait besoin d'ajouter d'autres statuts plus tard.
+// Prend en entrée une cible (string: IPv4, IPv6 ou nom DNS) et renvoie le statut (int, up = 1 et down = 0),
+// le dernier Round Trip Time (float64, milliisecondes) et l'adresse effectivement pingée (string, vide si la résolution a échoué).
+// Statut est un int et pas un bool car la topologie ajoute un troisième statut (injoignable = 2, voir applyStatus).
+// Une cible qui ne se résout pas ou qu'on ne peut pas pinger est considérée down.
 // On peut changer le nombre de paquets à envoyer et la durée avant timeout.
-func probeIP(IPaddr string) (int, float64) {
+func probeIP(target string) (int, float64, string) {
 
 	var RTT float64
 
+	// Résolution de la cible
+	ip, err := resolveTarget(target)
+	if err != nil {
+		logger.Warn("erreur lors de la résolution de la cible", "ip", target, "error", err)
+		return statutDown, RTT, ""
+	}
+
 	// Configuration du ping / 1e6
-	pinger, err := probing.NewPinger(IPaddr)
+	pinger, err := probing.NewPinger(ip.String())
 	if err != nil {
-		log.Fatalf("--- Erreur lors de la configuration du ping vers l'adresse spécifiée:\n%s", err)
+		logger.Warn("erreur lors de la configuration du ping", "ip", target, "resolu", ip.String(), "error", err)
+		return statutDown, RTT, ip.String()
 	}
 	pinger.Count = 1 // Nombre de paquets à envoyer.
 	pinger.SetPrivileged(true)
@@ -138,7 +339,8 @@ func probeIP(IPaddr string) (int, float64) {
 	// Exécution du ping
 	err = pinger.Run()
 	if err != nil {
-		log.Fatalf("--- Erreur lors de l'exécution du ping vers l'adresse spécifiée:\n%s", err)
+		logger.Warn("erreur lors de l'exécution du ping", "ip", target, "resolu", ip.String(), "error", err)
+		return statutDown, RTT, ip.String()
 	}
 
 	// pinger.Statistics().Rtts est un array contenant tous les RTTs enregistrés.
@@ -152,37 +354,157 @@ func probeIP(IPaddr string) (int, float64) {
 
 	// Résultat
 	if pinger.Statistics().PacketsRecv == pinger.Statistics().PacketsSent {
-		return 1, RTT
+		return statutUp, RTT, ip.String()
 	}
-	return 0, RTT
+	return statutDown, RTT, ip.String()
 }
 
-// Teste toutes les IPs mentionnées dans routers.json puis le ré-écrit.
+// Durée entre chaque passe de ping.
+const probeInterval = time.Second * 30
+
+// Teste toutes les IPs de l'inventaire puis enregistre les résultats.
+// Les statuts sont corrigés selon la topologie parent/enfant pour que seules les causes racines soient signalées down.
 // Ne prend rien en entrée et ne renvoie rien.
-// Fonction sans condition de sortie.
-func probeAll() {
+func sweep() {
+
+	logger.Debug("mise à jour du statut des routeurs")
+	start := time.Now()
 
-	var routers []Router
+	routers := inventory.snapshot()
+
+	// Statuts de la passe précédente, pour détecter les changements d'état
+	previous := make(map[string]int)
+	for _, v := range routers {
+		previous[v.IP] = v.Statut
+	}
+
+	// Construction du graphe de dépendances
+	topo, errs := buildTopology(routers)
+	for _, err := range errs {
+		logger.Warn("topologie invalide", "error", err)
+	}
+
+	// Test des IPs
+	for i := range routers {
+		routers[i].Statut, routers[i].RTT, routers[i].Resolu = probeIP(routers[i].IP)
+	}
+
+	// Correction des statuts selon la topologie et alertes
+	topo.applyStatus(routers)
+	topo.notifyStateChanges(previous, routers)
+
+	// Enregistrement des résultats dans l'inventaire et dans routers.json
+	inventory.update(routers)
+
+	lastSweep.record(start, time.Since(start), len(routers))
+	logger.Info("mise à jour terminée", "routers", len(routers), "duration_ms", time.Since(start).Milliseconds())
+}
+
+// Boucle de test des IPs, lancée en parallèle du traitement des requêtes HTTP.
+// Prend en entrée un contexte (context.Context) dont l'annulation arrête la boucle,
+// et un canal (<-chan struct{}) qui déclenche une passe immédiate (ex: après un rechargement), ne renvoie rien.
+// Une passe en cours n'est jamais interrompue: à l'arrêt, la fonction ne revient qu'une fois routers.json écrit.
+func probeAll(ctx context.Context, trigger <-chan struct{}) {
 
 	for {
-		fmt.Println("--- Mise à jour du statut des routeurs...")
+		sweep()
+
+		select {
+		case <-ctx.Done():
+			logger.Info("arrêt de la boucle de ping")
+			return
+		case <-trigger:
+		case <-time.After(probeInterval):
+		}
+	}
+}
+
+// Recharge la configuration, les certificats et l'inventaire sans interrompre le serveur HTTP, puis déclenche une passe de ping.
+// Prend en entrée le canal de déclenchement de probeAll (chan struct{}) et ne renvoie rien.
+// Appelée à la réception d'un SIGHUP. Une configuration ou un inventaire invalide est rejeté et l'ancien est conservé.
+func reload(trigger chan struct{}) {
 
-		routers = readJSON()
+	logger.Info("rechargement de la configuration")
+
+	err := reloadConfig()
+	if err != nil {
+		logger.Error("configuration invalide, l'ancienne est conservée", "error", err)
+	}
 
-		// Test des IPs
-		for i := range routers {
-			routers[i].Statut, routers[i].RTT = probeIP(routers[i].IP)
+	// Les certificats ne sont rechargés que si le serveur a démarré en HTTPS.
+	if certs.cert.Load() != nil {
+		err = certs.load(getConfig().HTTP.TLS)
+		if err != nil {
+			logger.Error("certificats invalides, les anciens sont conservés", "error", err)
 		}
+	}
 
-		// Ecriture du fichier JSON
-		writeJSON(routers)
+	err = inventory.load()
+	if err != nil {
+		logger.Error("inventaire invalide, le dernier inventaire valide est conservé", "file", getPath("routers.json"), "error", err)
+	}
 
-		fmt.Println("--- Mise à jour terminée.")
-		time.Sleep(time.Second * 30) // Durée entre chaque rafraîchissement
+	// Si une passe est déjà demandée, inutile d'en ajouter une autre.
+	select {
+	case trigger <- struct{}{}:
+	default:
 	}
 }
 
 func main() {
-	go probeAll() // Goroutine de test des IPs en parallèle du traitement des requêtes HTTP.
-	handleRequests()
+
+	// Création flags par défaut
+	var logLevel string = "info"
+	var logFormat string = "logfmt"
+
+	// Récupération des flags.
+	getopt.FlagLong(&logLevel, "log-level", 0, "Niveau de log minimum (debug, info, warn, error).\nDéfaut:")
+	getopt.FlagLong(&logFormat, "log-format", 0, "Format des logs (json, logfmt).\nDéfaut:")
+	getopt.ParseV2()
+
+	err := setupLogger(logLevel, logFormat)
+	if err != nil {
+		fatal("configuration des logs invalide", "error", err)
+	}
+
+	err = reloadConfig()
+	if err != nil {
+		fatal("configuration invalide", "error", err)
+	}
+
+	err = inventory.load()
+	if err != nil {
+		fatal("inventaire invalide", "file", getPath("routers.json"), "error", err)
+	}
+
+	// Arrêt propre sur SIGINT/SIGTERM, rechargement sur SIGHUP
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	trigger := make(chan struct{}, 1)
+	done := make(chan struct{})
+
+	go func() {
+		probeAll(ctx, trigger) // Goroutine de test des IPs en parallèle du traitement des requêtes HTTP.
+		close(done)
+	}()
+	go watchInventory(ctx)
+	go pollRouterOS(ctx)
+	go pollBackups(ctx)
+	go listenTraps(ctx)
+	go listenSyslog(ctx)
+	go pollSNMPAll(ctx)
+	go func() {
+		for range hup {
+			reload(trigger)
+		}
+	}()
+
+	handleRequests(ctx)
+
+	// On attend la fin de la passe de ping en cours avant de quitter.
+	<-done
+	logger.Info("arrêt terminé")
 }
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Métriques Prometheus exposées sur /metrics.
+// Les métriques liées à un routeur portent les labels ip et username, comme les logs.
+var (
+	trapsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "mikromap_snmp_traps_total",
+		Help: "Nombre de traps SNMP reçus, par routeur et par type de trap.",
+	}, []string{"ip", "username", "trap"})
+
+	trapsUnknownTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "mikromap_snmp_traps_unknown_source_total",
+		Help: "Nombre de traps SNMP reçus d'une adresse absente de routers.json.",
+	})
+
+	trapsRejectedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "mikromap_snmp_traps_rejected_total",
+		Help: "Nombre de traps SNMP ignorés à cause d'une communauté non autorisée.",
+	})
+
+	syslogTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "mikromap_syslog_messages_total",
+		Help: "Nombre de messages syslog reçus, par routeur et par niveau de gravité.",
+	}, []string{"ip", "username", "severity"})
+
+	syslogUnknownTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "mikromap_syslog_unknown_source_total",
+		Help: "Nombre de messages syslog ignorés car reçus d'une adresse absente de routers.json.",
+	})
+)
+
+func init() {
+	// Résultats de l'interrogation SNMP (voir snmp.go)
+	prometheus.MustRegister(snmpCollector)
+}
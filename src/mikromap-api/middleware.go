@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Clé de contexte pour l'identifiant de requête.
+type ctxKey int
+
+const requestIDKey ctxKey = 0
+
+// Enregistre le code de statut renvoyé par un handler, pour le log d'accès.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// Méthode de statusRecorder, voir http.ResponseWriter.
+func (rec *statusRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+// Middleware de log d'accès.
+// Attribue un identifiant à chaque requête (repris de l'en-tête X-Request-ID s'il est fourni), le renvoie dans la réponse,
+// puis journalise la requête une fois traitée (méthode, chemin, utilisateur, statut, durée).
+// Prend en entrée le handler suivant (http.Handler) et renvoie le handler enveloppé (http.Handler).
+func accessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+
+		start := time.Now()
+
+		// Identifiant de requête
+		id := request.Header.Get("X-Request-ID")
+		if id == "" {
+			id = uuid.NewString()
+		}
+		writer.Header().Set("X-Request-ID", id)
+		request = request.WithContext(context.WithValue(request.Context(), requestIDKey, id))
+
+		// Traitement de la requête
+		rec := &statusRecorder{ResponseWriter: writer, status: http.StatusOK}
+		next.ServeHTTP(rec, request)
+
+		logger.Info("requête HTTP",
+			"request_id", id,
+			"method", request.Method,
+			"path", request.URL.Path,
+			"username", request.URL.Query().Get("user"),
+			"remote", request.RemoteAddr,
+			"status", rec.status,
+			"duration_ms", float64(time.Since(start).Microseconds())/1e3,
+		)
+	})
+}
+
+// Middleware d'authentification.
+// Si des jetons ou des utilisateurs sont configurés (http.auth dans mikromap.json), la requête doit présenter
+// un en-tête Authorization: Bearer <jeton> ou Authorization: Basic valide, sinon elle est rejetée avec un 401.
+// La configuration est relue à chaque requête, donc les changements sont pris en compte au SIGHUP.
+// Prend en entrée le handler suivant (http.Handler) et renvoie le handler enveloppé (http.Handler).
+func authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+
+		conf := getConfig().HTTP.Auth
+
+		// Authentification désactivée
+		if len(conf.Tokens) == 0 && len(conf.Basic) == 0 {
+			next.ServeHTTP(writer, request)
+			return
+		}
+
+		// Jeton
+		if token, ok := strings.CutPrefix(request.Header.Get("Authorization"), "Bearer "); ok {
+			for _, v := range conf.Tokens {
+				if subtle.ConstantTimeCompare([]byte(token), []byte(v)) == 1 {
+					next.ServeHTTP(writer, request)
+					return
+				}
+			}
+		}
+
+		// Utilisateur et mot de passe
+		if user, pass, ok := request.BasicAuth(); ok {
+			if expected, found := conf.Basic[user]; found && subtle.ConstantTimeCompare([]byte(pass), []byte(expected)) == 1 {
+				next.ServeHTTP(writer, request)
+				return
+			}
+		}
+
+		requestLogger(request).Warn("requête non authentifiée", "path", request.URL.Path, "remote", request.RemoteAddr)
+		if len(conf.Basic) > 0 {
+			writer.Header().Set("WWW-Authenticate", `Basic realm="mikromap"`)
+		} else {
+			writer.Header().Set("WWW-Authenticate", `Bearer realm="mikromap"`)
+		}
+		http.Error(writer, "authentification requise", http.StatusUnauthorized)
+	})
+}
+
+// Renvoie un logger qui inclut l'identifiant de la requête en cours.
+// Prend en entrée la requête (*http.Request) et renvoie le logger (*slog.Logger).
+func requestLogger(request *http.Request) *slog.Logger {
+
+	id, _ := request.Context().Value(requestIDKey).(string)
+
+	return logger.With("request_id", id)
+}
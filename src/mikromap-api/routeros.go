@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Informations remontées par l'API RouterOS, ajoutées à chaque routeur dans la sortie de l'API.
+type RouterOSInfo struct {
+	Identite string    `json:"identite"` // /system/identity name
+	Modele   string    `json:"modele"`   // /system/resource board-name
+	Version  string    `json:"version"`  // /system/resource version (ex: "7.14.2 (stable)")
+	Uptime   string    `json:"uptime"`   // /system/resource uptime, au moment de l'interrogation
+	Serie    string    `json:"serie"`    // /system/routerboard serial-number (vide sur CHR/x86)
+	MajLe    time.Time `json:"maj_le"`   // Date de la dernière interrogation réussie
+}
+
+// Taille maximale d'un mot reçu de l'API RouterOS, pour ne pas allouer la longueur annoncée par un équipement défaillant.
+const routerOSMaxWord = 1 << 20
+
+// Connexion à l'API RouterOS d'un routeur.
+// Le protocole échange des phrases composées de mots préfixés par leur longueur, chaque phrase se terminant par un mot vide.
+// Voir https://help.mikrotik.com/docs/display/ROS/API
+type RouterOSClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// Ouvre une connexion à l'API RouterOS et s'authentifie.
+// Prend en entrée l'adresse du routeur (string), les identifiants (Credentials) et la configuration RouterOS (RouterOSConfig),
+// renvoie la connexion (*RouterOSClient) ou une erreur.
+// Utilise la méthode de login des versions 6.43 et suivantes (mot de passe en clair, à protéger avec api-ssl).
+func dialRouterOS(ctx context.Context, host string, creds Credentials, conf RouterOSConfig) (*RouterOSClient, error) {
+
+	var conn net.Conn
+	var err error
+
+	// Port par défaut selon le protocole
+	port := creds.Port
+	if port == 0 {
+		port = 8728
+		if conf.TLS {
+			port = 8729
+		}
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+
+	// Connexion
+	dialer := &net.Dialer{Timeout: time.Second * 5}
+	if conf.TLS {
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: &tls.Config{InsecureSkipVerify: conf.Insecure}}
+		conn, err = tlsDialer.DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(time.Second * 15))
+
+	client := &RouterOSClient{conn: conn, reader: bufio.NewReader(conn)}
+
+	// Authentification
+	_, err = client.run("/login", "=name="+creds.Username, "=password="+creds.Password)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("authentification refusée: %w", err)
+	}
+
+	return client, nil
+}
+
+// Ferme la connexion.
+// Méthode de *RouterOSClient. Ne prend rien en entrée et ne renvoie rien.
+func (client *RouterOSClient) Close() {
+	client.conn.Close()
+}
+
+// Exécute une commande et renvoie ses réponses.
+// Méthode de *RouterOSClient. Prend en entrée la commande et ses arguments (mots, ex: "/system/resource/print"),
+// renvoie les attributs de chaque réponse !re ([]map[string]string) ou l'erreur renvoyée par le routeur (!trap, !fatal).
+func (client *RouterOSClient) run(words ...string) ([]map[string]string, error) {
+
+	var res []map[string]string
+	var trap error
+
+	// Envoi de la phrase
+	var buf []byte
+	for _, w := range words {
+		buf = append(buf, encodeLength(len(w))...)
+		buf = append(buf, w...)
+	}
+	buf = append(buf, 0)
+	_, err := client.conn.Write(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	// Lecture des réponses jusqu'à !done
+	for {
+		sentence, err := client.readSentence()
+		if err != nil {
+			return nil, err
+		}
+		if len(sentence) == 0 {
+			continue
+		}
+
+		attrs := make(map[string]string)
+		for _, w := range sentence[1:] {
+			if kv, ok := strings.CutPrefix(w, "="); ok {
+				k, v, _ := strings.Cut(kv, "=")
+				attrs[k] = v
+			}
+		}
+
+		switch sentence[0] {
+		case "!re":
+			res = append(res, attrs)
+		case "!trap":
+			trap = errors.New(attrs["message"])
+		case "!fatal":
+			return nil, fmt.Errorf("erreur fatale: %s", strings.Join(sentence[1:], " "))
+		case "!done":
+			return res, trap
+		}
+	}
+}
+
+// Lit une phrase complète.
+// Méthode de *RouterOSClient. Ne prend rien en entrée et renvoie les mots de la phrase ([]string),
+// ou une erreur si la connexion échoue ou si un mot dépasse routerOSMaxWord.
+func (client *RouterOSClient) readSentence() ([]string, error) {
+
+	var sentence []string
+
+	for {
+		length, err := decodeLength(client.reader)
+		if err != nil {
+			return nil, err
+		}
+		if length == 0 {
+			return sentence, nil
+		}
+		if length > routerOSMaxWord {
+			return nil, fmt.Errorf("mot de %d octets reçu de l'API RouterOS (maximum %d)", length, routerOSMaxWord)
+		}
+		word := make([]byte, length)
+		_, err = io.ReadFull(client.reader, word)
+		if err != nil {
+			return nil, err
+		}
+		sentence = append(sentence, string(word))
+	}
+}
+
+// Encode la longueur d'un mot selon le protocole RouterOS (1 à 5 octets).
+// Prend en entrée la longueur (int) et renvoie les octets à envoyer ([]byte).
+func encodeLength(l int) []byte {
+
+	switch {
+	case l < 0x80:
+		return []byte{byte(l)}
+	case l < 0x4000:
+		return []byte{byte(l>>8) | 0x80, byte(l)}
+	case l < 0x200000:
+		return []byte{byte(l>>16) | 0xC0, byte(l >> 8), byte(l)}
+	case l < 0x10000000:
+		return []byte{byte(l>>24) | 0xE0, byte(l >> 16), byte(l >> 8), byte(l)}
+	default:
+		return []byte{0xF0, byte(l >> 24), byte(l >> 16), byte(l >> 8), byte(l)}
+	}
+}
+
+// Décode la longueur d'un mot selon le protocole RouterOS.
+// Prend en entrée le flux (*bufio.Reader) et renvoie la longueur (int).
+func decodeLength(reader *bufio.Reader) (int, error) {
+
+	first, err := reader.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+
+	// Nombre d'octets supplémentaires selon les bits de poids fort du premier octet
+	var extra int
+	var l int
+	switch {
+	case first&0x80 == 0:
+		return int(first), nil
+	case first&0xC0 == 0x80:
+		extra, l = 1, int(first&0x3F)
+	case first&0xE0 == 0xC0:
+		extra, l = 2, int(first&0x1F)
+	case first&0xF0 == 0xE0:
+		extra, l = 3, int(first&0x0F)
+	default:
+		extra, l = 4, 0
+	}
+
+	for i := 0; i < extra; i++ {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		l = l<<8 | int(b)
+	}
+
+	return l, nil
+}
+
+// Interroge un routeur et renvoie ses informations.
+// Prend en entrée un contexte (context.Context), l'adresse à joindre (string), les identifiants (Credentials) et la configuration (RouterOSConfig),
+// renvoie les informations (RouterOSInfo) ou une erreur.
+func fetchRouterOSInfo(ctx context.Context, host string, creds Credentials, conf RouterOSConfig) (RouterOSInfo, error) {
+
+	var info RouterOSInfo
+
+	client, err := dialRouterOS(ctx, host, creds, conf)
+	if err != nil {
+		return info, err
+	}
+	defer client.Close()
+
+	// Identité
+	res, err := client.run("/system/identity/print")
+	if err != nil {
+		return info, fmt.Errorf("/system/identity: %w", err)
+	}
+	if len(res) > 0 {
+		info.Identite = res[0]["name"]
+	}
+
+	// Modèle, version et uptime
+	res, err = client.run("/system/resource/print")
+	if err != nil {
+		return info, fmt.Errorf("/system/resource: %w", err)
+	}
+	if len(res) > 0 {
+		info.Modele, info.Version, info.Uptime = res[0]["board-name"], res[0]["version"], res[0]["uptime"]
+	}
+
+	// Numéro de série (absent sur les installations non-RouterBOARD)
+	res, err = client.run("/system/routerboard/print")
+	if err == nil && len(res) > 0 {
+		info.Serie = res[0]["serial-number"]
+	}
+
+	info.MajLe = time.Now()
+
+	return info, nil
+}
+
+// Boucle d'interrogation des routeurs via l'API RouterOS.
+// Prend en entrée un contexte (context.Context) dont l'annulation arrête la boucle, et ne renvoie rien.
+// Seuls les routeurs sous RouterOS (voir DeviceProfile), up et pour lesquels des identifiants sont configurés sont interrogés.
+// La configuration est relue à chaque tour, l'interrogation peut donc être activée ou désactivée par SIGHUP.
+func pollRouterOS(ctx context.Context) {
+
+	for {
+		config := getConfig()
+		conf := config.RouterOS
+
+		if conf.Enabled {
+			for _, v := range inventory.snapshot() {
+				creds := conf.credentials(v.IP)
+				if v.Statut != statutUp || creds.Username == "" || !config.isRouterOS(v) {
+					continue
+				}
+				if ctx.Err() != nil {
+					return
+				}
+
+				// On joint l'adresse résolue lors du dernier ping pour suivre les noms DNS.
+				host := v.IP
+				if v.Resolu != "" {
+					host = v.Resolu
+				}
+
+				info, err := fetchRouterOSInfo(ctx, host, creds, conf)
+				if err != nil {
+					routerLogger(v).Warn("erreur lors de l'interrogation de l'API RouterOS", "error", err)
+					continue
+				}
+				inventory.updateRouter(v.IP, func(r *Router) {
+					r.RouterOS = &info
+				})
+				routerLogger(v).Debug("informations RouterOS mises à jour", "identite", info.Identite, "version", info.Version)
+			}
+		}
+
+		// Pas plus d'une interrogation par minute, même si l'intervalle configuré est plus court
+		interval := time.Duration(conf.Interval)
+		if interval < time.Minute {
+			interval = time.Minute
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
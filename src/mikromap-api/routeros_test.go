@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestRouterOSLength(t *testing.T) {
+
+	// Exemples de la documentation de l'API RouterOS
+	tests := []struct {
+		length  int
+		encoded []byte
+	}{
+		{0x00, []byte{0x00}},
+		{0x7F, []byte{0x7F}},
+		{0x80, []byte{0x80, 0x80}},
+		{0x3FFF, []byte{0xBF, 0xFF}},
+		{0x4000, []byte{0xC0, 0x40, 0x00}},
+		{0x1FFFFF, []byte{0xDF, 0xFF, 0xFF}},
+		{0x200000, []byte{0xE0, 0x20, 0x00, 0x00}},
+		{0xFFFFFFF, []byte{0xEF, 0xFF, 0xFF, 0xFF}},
+		{0x10000000, []byte{0xF0, 0x10, 0x00, 0x00, 0x00}},
+	}
+
+	for _, tt := range tests {
+		if got := encodeLength(tt.length); !bytes.Equal(got, tt.encoded) {
+			t.Errorf("encodeLength(%#x) = % X, attendu % X", tt.length, got, tt.encoded)
+		}
+		got, err := decodeLength(bufio.NewReader(bytes.NewReader(tt.encoded)))
+		if err != nil || got != tt.length {
+			t.Errorf("decodeLength(% X) = %#x, %v, attendu %#x", tt.encoded, got, err, tt.length)
+		}
+	}
+
+	if _, err := decodeLength(bufio.NewReader(bytes.NewReader([]byte{0xC0, 0x40}))); err == nil {
+		t.Error("decodeLength d'une longueur tronquée: pas d'erreur")
+	}
+}
+
+func TestRouterOSRun(t *testing.T) {
+
+	client, router := net.Pipe()
+	defer client.Close()
+	defer router.Close()
+
+	// Faux routeur: lit la commande puis renvoie une réponse !re, un !trap et !done
+	received := make(chan []string, 1)
+	go func() {
+		fake := RouterOSClient{conn: router, reader: bufio.NewReader(router)}
+		sentence, _ := fake.readSentence()
+		received <- sentence
+		var buf []byte
+		for _, s := range [][]string{
+			{"!re", "=version=7.14.2 (stable)", "=board-name=RB5009", "=empty="},
+			{"!trap", "=message=no such command"},
+			{"!done"},
+		} {
+			for _, w := range s {
+				buf = append(buf, encodeLength(len(w))...)
+				buf = append(buf, w...)
+			}
+			buf = append(buf, 0)
+		}
+		router.Write(buf)
+	}()
+
+	conn := RouterOSClient{conn: client, reader: bufio.NewReader(client)}
+	res, err := conn.run("/system/resource/print", "?board-name=RB5009")
+
+	if got := <-received; !reflect.DeepEqual(got, []string{"/system/resource/print", "?board-name=RB5009"}) {
+		t.Errorf("commande reçue = %q", got)
+	}
+	want := []map[string]string{{"version": "7.14.2 (stable)", "board-name": "RB5009", "empty": ""}}
+	if !reflect.DeepEqual(res, want) {
+		t.Errorf("réponses = %v, attendu %v", res, want)
+	}
+	if err == nil || err.Error() != "no such command" {
+		t.Errorf("erreur = %v, attendu le message du !trap", err)
+	}
+}
+
+func TestRouterOSWordLimit(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		length int
+		ok     bool
+	}{
+		{"mot à la limite", routerOSMaxWord, true},
+		{"mot trop long", routerOSMaxWord + 1, false},
+		{"longueur maximum du protocole", 0xFFFFFFFF, false},
+	}
+	for _, tt := range tests {
+		// Seul le mot à la limite est suivi de son contenu: les autres doivent être refusés sans attendre les données
+		data := encodeLength(tt.length)
+		if tt.ok {
+			data = append(append(data, bytes.Repeat([]byte{'a'}, tt.length)...), 0)
+		}
+		client := RouterOSClient{reader: bufio.NewReader(bytes.NewReader(data))}
+		sentence, err := client.readSentence()
+		if tt.ok && (err != nil || len(sentence) != 1 || len(sentence[0]) != tt.length) {
+			t.Errorf("%s: %d mot(s), erreur %v", tt.name, len(sentence), err)
+		}
+		if !tt.ok && (err == nil || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF)) {
+			t.Errorf("%s: erreur = %v, attendu un refus de la longueur", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// OID interrogés (MIB-II, HOST-RESOURCES-MIB, IF-MIB et MIKROTIK-MIB).
+const (
+	oidSysUpTime            = ".1.3.6.1.2.1.1.3.0"
+	oidHrProcessorLoad      = ".1.3.6.1.2.1.25.3.3.1.2"
+	oidHrStorageType        = ".1.3.6.1.2.1.25.2.3.1.2"
+	oidHrStorageUnits       = ".1.3.6.1.2.1.25.2.3.1.4"
+	oidHrStorageSize        = ".1.3.6.1.2.1.25.2.3.1.5"
+	oidHrStorageUsed        = ".1.3.6.1.2.1.25.2.3.1.6"
+	oidHrStorageRam         = ".1.3.6.1.2.1.25.2.1.2"
+	oidIfName               = ".1.3.6.1.2.1.31.1.1.1.1"
+	oidIfHCInOctets         = ".1.3.6.1.2.1.31.1.1.1.6"
+	oidIfHCOutOctets        = ".1.3.6.1.2.1.31.1.1.1.10"
+	oidIfOperStatus         = ".1.3.6.1.2.1.2.2.1.8"
+	oidIfInErrors           = ".1.3.6.1.2.1.2.2.1.14"
+	oidIfOutErrors          = ".1.3.6.1.2.1.2.2.1.20"
+	oidMtxrHlTemperature    = ".1.3.6.1.4.1.14988.1.1.3.10.0" // Température de la carte, en dixièmes de degré
+	oidMtxrHlCpuTemperature = ".1.3.6.1.4.1.14988.1.1.3.11.0" // Température du processeur, en dixièmes de degré
+)
+
+// Compteurs d'une interface.
+type InterfaceStats struct {
+	InOctets  float64
+	OutOctets float64
+	InErrors  float64
+	OutErrors float64
+	Up        bool
+}
+
+// Résultat de la dernière interrogation SNMP d'un routeur.
+type SNMPResult struct {
+	IP           string
+	Username     string
+	Up           bool // L'interrogation a réussi
+	Uptime       float64
+	CPULoad      float64            // Charge moyenne des processeurs, en pourcentage
+	MemoryTotal  float64            // Octets
+	MemoryUsed   float64            // Octets
+	Temperatures map[string]float64 // Capteur (board, cpu) -> degrés Celsius
+	Interfaces   map[string]InterfaceStats
+}
+
+// Collecteur Prometheus des résultats SNMP.
+// Les métriques sont générées à chaque scrape à partir des derniers résultats, ce qui évite de conserver les séries des routeurs supprimés.
+type SNMPCollector struct {
+	mu      sync.RWMutex
+	results map[string]SNMPResult // IP du routeur -> dernier résultat
+}
+
+// Résultats SNMP exposés sur /metrics.
+var snmpCollector = &SNMPCollector{results: make(map[string]SNMPResult)}
+
+// Descriptions des métriques SNMP.
+var (
+	snmpUpDesc          = prometheus.NewDesc("mikromap_snmp_up", "1 si la dernière interrogation SNMP du routeur a réussi.", []string{"ip", "username"}, nil)
+	snmpUptimeDesc      = prometheus.NewDesc("mikromap_snmp_uptime_seconds", "Uptime du routeur (sysUpTime).", []string{"ip", "username"}, nil)
+	snmpCPUDesc         = prometheus.NewDesc("mikromap_snmp_cpu_load_percent", "Charge moyenne des processeurs (hrProcessorLoad).", []string{"ip", "username"}, nil)
+	snmpMemTotalDesc    = prometheus.NewDesc("mikromap_snmp_memory_total_bytes", "Mémoire totale (hrStorageSize).", []string{"ip", "username"}, nil)
+	snmpMemUsedDesc     = prometheus.NewDesc("mikromap_snmp_memory_used_bytes", "Mémoire utilisée (hrStorageUsed).", []string{"ip", "username"}, nil)
+	snmpTempDesc        = prometheus.NewDesc("mikromap_snmp_temperature_celsius", "Température (mtxrHlTemperature, mtxrHlCpuTemperature).", []string{"ip", "username", "sensor"}, nil)
+	snmpIfInDesc        = prometheus.NewDesc("mikromap_snmp_interface_in_octets_total", "Octets reçus par interface (ifHCInOctets).", []string{"ip", "username", "interface"}, nil)
+	snmpIfOutDesc       = prometheus.NewDesc("mikromap_snmp_interface_out_octets_total", "Octets envoyés par interface (ifHCOutOctets).", []string{"ip", "username", "interface"}, nil)
+	snmpIfInErrorsDesc  = prometheus.NewDesc("mikromap_snmp_interface_in_errors_total", "Erreurs en réception par interface (ifInErrors).", []string{"ip", "username", "interface"}, nil)
+	snmpIfOutErrorsDesc = prometheus.NewDesc("mikromap_snmp_interface_out_errors_total", "Erreurs en émission par interface (ifOutErrors).", []string{"ip", "username", "interface"}, nil)
+	snmpIfUpDesc        = prometheus.NewDesc("mikromap_snmp_interface_up", "1 si l'interface est up (ifOperStatus).", []string{"ip", "username", "interface"}, nil)
+)
+
+// Méthode de *SNMPCollector, voir prometheus.Collector.
+func (c *SNMPCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(c, ch)
+}
+
+// Méthode de *SNMPCollector, voir prometheus.Collector.
+func (c *SNMPCollector) Collect(ch chan<- prometheus.Metric) {
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, r := range c.results {
+		up := 0.0
+		if r.Up {
+			up = 1
+		}
+		ch <- prometheus.MustNewConstMetric(snmpUpDesc, prometheus.GaugeValue, up, r.IP, r.Username)
+		if !r.Up {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(snmpUptimeDesc, prometheus.GaugeValue, r.Uptime, r.IP, r.Username)
+		ch <- prometheus.MustNewConstMetric(snmpCPUDesc, prometheus.GaugeValue, r.CPULoad, r.IP, r.Username)
+		if r.MemoryTotal > 0 {
+			ch <- prometheus.MustNewConstMetric(snmpMemTotalDesc, prometheus.GaugeValue, r.MemoryTotal, r.IP, r.Username)
+			ch <- prometheus.MustNewConstMetric(snmpMemUsedDesc, prometheus.GaugeValue, r.MemoryUsed, r.IP, r.Username)
+		}
+		for sensor, v := range r.Temperatures {
+			ch <- prometheus.MustNewConstMetric(snmpTempDesc, prometheus.GaugeValue, v, r.IP, r.Username, sensor)
+		}
+		for name, v := range r.Interfaces {
+			ifUp := 0.0
+			if v.Up {
+				ifUp = 1
+			}
+			ch <- prometheus.MustNewConstMetric(snmpIfInDesc, prometheus.CounterValue, v.InOctets, r.IP, r.Username, name)
+			ch <- prometheus.MustNewConstMetric(snmpIfOutDesc, prometheus.CounterValue, v.OutOctets, r.IP, r.Username, name)
+			ch <- prometheus.MustNewConstMetric(snmpIfInErrorsDesc, prometheus.CounterValue, v.InErrors, r.IP, r.Username, name)
+			ch <- prometheus.MustNewConstMetric(snmpIfOutErrorsDesc, prometheus.CounterValue, v.OutErrors, r.IP, r.Username, name)
+			ch <- prometheus.MustNewConstMetric(snmpIfUpDesc, prometheus.GaugeValue, ifUp, r.IP, r.Username, name)
+		}
+	}
+}
+
+// Remplace les résultats exposés.
+// Méthode de *SNMPCollector. Prend en entrée les résultats de la dernière passe (map[string]SNMPResult) et ne renvoie rien.
+func (c *SNMPCollector) set(results map[string]SNMPResult) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.results = results
+}
+
+// Prépare une session SNMP vers un routeur.
+// Prend en entrée un contexte (context.Context), l'adresse à joindre (string) et les paramètres SNMP (SNMPCredentials),
+// renvoie la session (*gosnmp.GoSNMP), à connecter, ou une erreur si les paramètres sont invalides.
+func newSNMPSession(ctx context.Context, host string, creds SNMPCredentials) (*gosnmp.GoSNMP, error) {
+
+	session := &gosnmp.GoSNMP{
+		Context:        ctx,
+		Target:         host,
+		Port:           uint16(creds.Port),
+		Timeout:        time.Second * 3,
+		Retries:        1,
+		MaxRepetitions: 25,
+		MaxOids:        gosnmp.MaxOids,
+	}
+	if session.Port == 0 {
+		session.Port = 161
+	}
+
+	switch creds.Version {
+	case "", "2c":
+		session.Version = gosnmp.Version2c
+		session.Community = creds.Community
+		if session.Community == "" {
+			session.Community = "public"
+		}
+
+	case "3":
+		params := &gosnmp.UsmSecurityParameters{
+			UserName:                 creds.Username,
+			AuthenticationPassphrase: creds.AuthPassword,
+			PrivacyPassphrase:        creds.PrivPassword,
+		}
+		session.Version = gosnmp.Version3
+		session.SecurityModel = gosnmp.UserSecurityModel
+		session.SecurityParameters = params
+		session.MsgFlags = gosnmp.NoAuthNoPriv
+
+		if creds.AuthProtocol != "" {
+			auth := map[string]gosnmp.SnmpV3AuthProtocol{"MD5": gosnmp.MD5, "SHA": gosnmp.SHA, "SHA224": gosnmp.SHA224, "SHA256": gosnmp.SHA256, "SHA384": gosnmp.SHA384, "SHA512": gosnmp.SHA512}
+			protocol, ok := auth[strings.ToUpper(creds.AuthProtocol)]
+			if !ok {
+				return nil, fmt.Errorf("protocole d'authentification SNMP inconnu: %s", creds.AuthProtocol)
+			}
+			params.AuthenticationProtocol = protocol
+			session.MsgFlags = gosnmp.AuthNoPriv
+		}
+		if creds.PrivProtocol != "" {
+			priv := map[string]gosnmp.SnmpV3PrivProtocol{"DES": gosnmp.DES, "AES": gosnmp.AES, "AES192": gosnmp.AES192, "AES256": gosnmp.AES256}
+			protocol, ok := priv[strings.ToUpper(creds.PrivProtocol)]
+			if !ok {
+				return nil, fmt.Errorf("protocole de chiffrement SNMP inconnu: %s", creds.PrivProtocol)
+			}
+			if session.MsgFlags != gosnmp.AuthNoPriv {
+				return nil, fmt.Errorf("le chiffrement SNMPv3 nécessite une authentification (auth_protocol)")
+			}
+			params.PrivacyProtocol = protocol
+			session.MsgFlags = gosnmp.AuthPriv
+		}
+
+	default:
+		return nil, fmt.Errorf("version SNMP non supportée: %s (2c ou 3)", creds.Version)
+	}
+
+	return session, nil
+}
+
+// Convertit la valeur numérique d'une variable SNMP.
+// Prend en entrée la variable (gosnmp.SnmpPDU) et renvoie sa valeur (float64).
+func snmpFloat(pdu gosnmp.SnmpPDU) float64 {
+
+	f, _ := new(big.Float).SetInt(gosnmp.ToBigInt(pdu.Value)).Float64()
+	return f
+}
+
+// Interroge un routeur en SNMP.
+// Prend en entrée un contexte (context.Context), l'adresse à joindre (string) et les paramètres SNMP (SNMPCredentials),
+// renvoie le résultat (SNMPResult), sans les champs liés au routeur, ou une erreur.
+// Seul sysUpTime est obligatoire: les autres valeurs absentes (ex: température sur CHR) sont ignorées.
+func pollSNMP(ctx context.Context, host string, creds SNMPCredentials) (SNMPResult, error) {
+
+	res := SNMPResult{Temperatures: make(map[string]float64), Interfaces: make(map[string]InterfaceStats)}
+
+	session, err := newSNMPSession(ctx, host, creds)
+	if err != nil {
+		return res, err
+	}
+	err = session.Connect()
+	if err != nil {
+		return res, err
+	}
+	defer session.Conn.Close()
+
+	// Valeurs scalaires
+	packet, err := session.Get([]string{oidSysUpTime, oidMtxrHlTemperature, oidMtxrHlCpuTemperature})
+	if err != nil {
+		return res, err
+	}
+	for _, v := range packet.Variables {
+		if v.Type == gosnmp.NoSuchObject || v.Type == gosnmp.NoSuchInstance || v.Type == gosnmp.Null {
+			continue
+		}
+		switch v.Name {
+		case oidSysUpTime:
+			res.Uptime = snmpFloat(v) / 100
+		case oidMtxrHlTemperature:
+			res.Temperatures["board"] = snmpFloat(v) / 10
+		case oidMtxrHlCpuTemperature:
+			res.Temperatures["cpu"] = snmpFloat(v) / 10
+		}
+	}
+
+	// Tables, indexées par le dernier élément de l'OID
+	walk := func(root string) map[string]gosnmp.SnmpPDU {
+		table := make(map[string]gosnmp.SnmpPDU)
+		pdus, err := session.BulkWalkAll(root)
+		if err != nil {
+			return table
+		}
+		for _, v := range pdus {
+			table[strings.TrimPrefix(v.Name, root+".")] = v
+		}
+		return table
+	}
+
+	// Charge processeur
+	cpus := walk(oidHrProcessorLoad)
+	for _, v := range cpus {
+		res.CPULoad += snmpFloat(v) / float64(len(cpus))
+	}
+
+	// Mémoire vive
+	for index, v := range walk(oidHrStorageType) {
+		if snmpValue(v) != oidHrStorageRam {
+			continue
+		}
+		packet, err := session.Get([]string{oidHrStorageUnits + "." + index, oidHrStorageSize + "." + index, oidHrStorageUsed + "." + index})
+		if err != nil || len(packet.Variables) != 3 {
+			continue
+		}
+		units := snmpFloat(packet.Variables[0])
+		res.MemoryTotal, res.MemoryUsed = snmpFloat(packet.Variables[1])*units, snmpFloat(packet.Variables[2])*units
+		break
+	}
+
+	// Interfaces
+	in, out := walk(oidIfHCInOctets), walk(oidIfHCOutOctets)
+	inErrors, outErrors := walk(oidIfInErrors), walk(oidIfOutErrors)
+	status := walk(oidIfOperStatus)
+	for index, v := range walk(oidIfName) {
+		res.Interfaces[snmpValue(v)] = InterfaceStats{
+			InOctets:  snmpFloat(in[index]),
+			OutOctets: snmpFloat(out[index]),
+			InErrors:  snmpFloat(inErrors[index]),
+			OutErrors: snmpFloat(outErrors[index]),
+			Up:        snmpFloat(status[index]) == 1,
+		}
+	}
+
+	res.Up = true
+
+	return res, nil
+}
+
+// Boucle d'interrogation SNMP des routeurs.
+// Prend en entrée un contexte (context.Context) dont l'annulation arrête la boucle, et ne renvoie rien.
+// Seuls les routeurs up sont interrogés, les résultats sont exposés sur /metrics.
+// La configuration est relue à chaque tour, l'interrogation peut donc être activée ou désactivée par SIGHUP.
+func pollSNMPAll(ctx context.Context) {
+
+	for {
+		conf := getConfig().SNMP
+		results := make(map[string]SNMPResult)
+
+		if conf.Enabled {
+			var mu sync.Mutex
+			var wg sync.WaitGroup
+			sem := make(chan struct{}, 16) // Interrogations simultanées
+
+			for _, v := range inventory.snapshot() {
+				if v.Statut != statutUp {
+					continue
+				}
+				host := v.IP
+				if v.Resolu != "" {
+					host = v.Resolu
+				}
+
+				wg.Add(1)
+				sem <- struct{}{}
+				go func(router Router, host string) {
+					defer wg.Done()
+					defer func() { <-sem }()
+
+					res, err := pollSNMP(ctx, host, conf.credentials(router.IP))
+					if err != nil {
+						routerLogger(router).Warn("erreur lors de l'interrogation SNMP", "error", err)
+					}
+					res.IP, res.Username = router.IP, router.Username
+
+					mu.Lock()
+					results[router.IP] = res
+					mu.Unlock()
+				}(v, host)
+			}
+			wg.Wait()
+		}
+		snmpCollector.set(results)
+
+		// Pas plus d'une interrogation toutes les 15 secondes, même si l'intervalle configuré est plus court
+		interval := time.Duration(conf.Interval)
+		if interval < time.Second*15 {
+			interval = time.Second * 15
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
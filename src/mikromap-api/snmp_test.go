@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gosnmp/gosnmp"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestNewSNMPSession(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		creds     SNMPCredentials
+		version   gosnmp.SnmpVersion
+		community string
+		port      uint16
+		flags     gosnmp.SnmpV3MsgFlags
+		err       bool
+	}{
+		{"v2c par défaut", SNMPCredentials{}, gosnmp.Version2c, "public", 161, 0, false},
+		{"v2c", SNMPCredentials{Version: "2c", Community: "supervision", Port: 1161}, gosnmp.Version2c, "supervision", 1161, 0, false},
+		{"v3 noAuthNoPriv", SNMPCredentials{Version: "3", Username: "u"}, gosnmp.Version3, "", 161, gosnmp.NoAuthNoPriv, false},
+		{"v3 authNoPriv", SNMPCredentials{Version: "3", Username: "u", AuthProtocol: "sha256", AuthPassword: "p"}, gosnmp.Version3, "", 161, gosnmp.AuthNoPriv, false},
+		{"v3 authPriv", SNMPCredentials{Version: "3", Username: "u", AuthProtocol: "SHA", AuthPassword: "p", PrivProtocol: "aes", PrivPassword: "q"}, gosnmp.Version3, "", 161, gosnmp.AuthPriv, false},
+		{"v3 chiffrement sans authentification", SNMPCredentials{Version: "3", Username: "u", PrivProtocol: "AES"}, 0, "", 0, 0, true},
+		{"v3 authentification inconnue", SNMPCredentials{Version: "3", AuthProtocol: "SHA1024"}, 0, "", 0, 0, true},
+		{"v3 chiffrement inconnu", SNMPCredentials{Version: "3", AuthProtocol: "SHA", PrivProtocol: "3DES"}, 0, "", 0, 0, true},
+		{"v1", SNMPCredentials{Version: "1"}, 0, "", 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session, err := newSNMPSession(context.Background(), "10.0.0.1", tt.creds)
+			if (err != nil) != tt.err {
+				t.Fatalf("erreur = %v, attendu erreur = %v", err, tt.err)
+			}
+			if tt.err {
+				return
+			}
+			if session.Version != tt.version || session.Community != tt.community || session.Port != tt.port || session.MsgFlags != tt.flags {
+				t.Errorf("version, communauté, port, flags = %v, %q, %d, %v, attendu %v, %q, %d, %v",
+					session.Version, session.Community, session.Port, session.MsgFlags, tt.version, tt.community, tt.port, tt.flags)
+			}
+		})
+	}
+}
+
+func TestSnmpFloat(t *testing.T) {
+
+	tests := []struct {
+		value any
+		want  float64
+	}{
+		{uint32(4200), 4200},
+		{uint64(1 << 40), 1 << 40},
+		{-12, -12},
+		{uint(7), 7},
+		{nil, 0},
+	}
+
+	for _, tt := range tests {
+		if got := snmpFloat(gosnmp.SnmpPDU{Value: tt.value}); got != tt.want {
+			t.Errorf("snmpFloat(%v) = %v, attendu %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestSNMPCollector(t *testing.T) {
+
+	collector := &SNMPCollector{}
+	collector.set(map[string]SNMPResult{
+		"10.0.0.1": {
+			IP: "10.0.0.1", Username: "C1", Up: true, Uptime: 3600, CPULoad: 5,
+			MemoryTotal: 1024, MemoryUsed: 512,
+			Temperatures: map[string]float64{"cpu": 45},
+			Interfaces:   map[string]InterfaceStats{"ether1": {InOctets: 10, Up: true}, "ether2": {}},
+		},
+		"10.0.0.2": {IP: "10.0.0.2", Username: "C2"},
+	})
+
+	// Routeur joignable: up, uptime, cpu, 2 mémoires, 1 température, 2 interfaces x 5. Routeur injoignable: up seul.
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(collector)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	count := 0
+	for _, f := range families {
+		count += len(f.GetMetric())
+		if f.GetName() == "mikromap_snmp_up" {
+			for _, m := range f.GetMetric() {
+				want := 0.0
+				if m.GetLabel()[0].GetValue() == "10.0.0.1" {
+					want = 1
+				}
+				if m.GetGauge().GetValue() != want {
+					t.Errorf("mikromap_snmp_up %v = %v, attendu %v", m.GetLabel(), m.GetGauge().GetValue(), want)
+				}
+			}
+		}
+	}
+	if want := 1 + 1 + 1 + 2 + 1 + 2*5 + 1; count != want {
+		t.Errorf("%d métriques, attendu %d", count, want)
+	}
+}
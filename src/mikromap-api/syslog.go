@@ -0,0 +1,410 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	syslog "github.com/leodido/go-syslog/v4"
+	"github.com/leodido/go-syslog/v4/rfc3164"
+	"github.com/leodido/go-syslog/v4/rfc5424"
+)
+
+// Taille maximale d'un message syslog.
+const syslogMaxSize = 8192
+
+// Noms des niveaux de gravité syslog, du plus grave au moins grave (RFC 5424).
+var syslogSeverities = []string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+
+// Parseurs syslog, en mode "best effort" pour conserver les messages partiellement conformes.
+var (
+	parserRFC3164 = rfc3164.NewParser(rfc3164.WithBestEffort(), rfc3164.WithYear(rfc3164.CurrentYear{}), rfc3164.WithLocaleTimezone(time.Local))
+	parserRFC5424 = rfc5424.NewParser(rfc5424.WithBestEffort())
+)
+
+// Message syslog reçu d'un routeur.
+type LogEntry struct {
+	Date     time.Time `json:"date"`     // Date du message (date de réception si le message n'en contient pas)
+	Recu     time.Time `json:"recu"`     // Date de réception
+	IP       string    `json:"ip"`       // IP du routeur dans routers.json
+	Username string    `json:"username"` // Utilisateur Grafana principal du routeur
+	Hostname string    `json:"hostname,omitempty"`
+	Facility string    `json:"facility,omitempty"`
+	Severity string    `json:"severity"`      // Niveau de gravité (emerg, alert, crit, err, warning, notice, info, debug)
+	App      string    `json:"app,omitempty"` // Tag (RFC 3164) ou APP-NAME (RFC 5424)
+	Message  string    `json:"message"`
+}
+
+// Derniers messages syslog reçus, par routeur.
+// Le nombre de messages conservés par routeur est limité (syslog.buffer dans mikromap.json), les plus anciens sont oubliés.
+type LogStore struct {
+	mu      sync.RWMutex
+	entries map[string][]LogEntry // IP du routeur -> messages, dans l'ordre d'arrivée
+}
+
+// Messages syslog reçus par l'API.
+var logStore = LogStore{entries: make(map[string][]LogEntry)}
+
+// Ajoute un message au tampon de son routeur.
+// Méthode de *LogStore. Prend en entrée le message (LogEntry) et le nombre maximum de messages par routeur (int), ne renvoie rien.
+func (store *LogStore) add(entry LogEntry, size int) {
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	entries := append(store.entries[entry.IP], entry)
+	if len(entries) > size {
+		entries = slices.Delete(entries, 0, len(entries)-size)
+	}
+	store.entries[entry.IP] = entries
+}
+
+// Renvoie les messages d'un routeur, du plus récent au plus ancien.
+// Méthode de *LogStore. Prend en entrée l'IP du routeur (string), une fonction de filtre (func(LogEntry) bool) et le nombre maximum de messages (int),
+// renvoie les messages retenus ([]LogEntry).
+func (store *LogStore) list(ip string, keep func(LogEntry) bool, limit int) []LogEntry {
+
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	res := []LogEntry{}
+	entries := store.entries[ip]
+	for i := len(entries) - 1; i >= 0 && len(res) < limit; i-- {
+		if keep(entries[i]) {
+			res = append(res, entries[i])
+		}
+	}
+
+	return res
+}
+
+// Oublie les messages des routeurs qui ne sont plus dans l'inventaire.
+// Méthode de *LogStore. Prend en entrée les routeurs de l'inventaire ([]Router) et ne renvoie rien.
+func (store *LogStore) prune(routers []Router) {
+
+	known := make(map[string]bool)
+	for _, v := range routers {
+		known[v.IP] = true
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for ip := range store.entries {
+		if !known[ip] {
+			delete(store.entries, ip)
+		}
+	}
+}
+
+// Décode un message syslog au format RFC 5424 ou RFC 3164.
+// Prend en entrée le message brut ([]byte) et renvoie le message décodé (LogEntry), sans les champs liés au routeur.
+// Un message illisible est conservé tel quel avec le niveau notice.
+func parseSyslog(data []byte) LogEntry {
+
+	now := time.Now()
+	entry := LogEntry{Date: now, Recu: now, Severity: "notice", Message: strings.TrimSpace(string(data))}
+
+	// RFC 5424 si la priorité est suivie d'un numéro de version (ex: "<30>1 "), RFC 3164 sinon
+	parser := parserRFC3164
+	if i := strings.IndexByte(entry.Message, '>'); i > 0 && strings.HasPrefix(entry.Message[i+1:], "1 ") {
+		parser = parserRFC5424
+	}
+
+	msg, _ := parser.Parse(data)
+	var base *syslog.Base
+	switch m := msg.(type) {
+	case *rfc3164.SyslogMessage:
+		base = &m.Base
+	case *rfc5424.SyslogMessage:
+		base = &m.Base
+	}
+	if base == nil || !base.Valid() {
+		return entry
+	}
+
+	if base.Timestamp != nil {
+		entry.Date = *base.Timestamp
+	}
+	if base.Severity != nil && int(*base.Severity) < len(syslogSeverities) {
+		entry.Severity = syslogSeverities[*base.Severity]
+	}
+	if f := base.FacilityLevel(); f != nil {
+		entry.Facility = *f
+	}
+	if base.Hostname != nil {
+		entry.Hostname = *base.Hostname
+	}
+	if base.Appname != nil {
+		entry.App = *base.Appname
+	}
+	if base.Message != nil {
+		entry.Message = strings.TrimSpace(*base.Message)
+	}
+
+	// RouterOS n'envoie pas de tag mais préfixe le message par ses topics (ex: "system,info,account user admin logged in")
+	if topics, rest, ok := strings.Cut(entry.Message, " "); entry.App == "" && ok && strings.Contains(topics, ",") && strings.Trim(topics, "abcdefghijklmnopqrstuvwxyz0123456789-,") == "" {
+		entry.App, entry.Message = topics, rest
+	}
+
+	return entry
+}
+
+// Traite un message syslog reçu: rattachement à un routeur, enregistrement et métriques.
+// Prend en entrée le message brut ([]byte) et l'adresse d'origine (net.IP), ne renvoie rien.
+// Les messages d'adresses absentes de routers.json sont ignorés.
+func handleSyslog(data []byte, source net.IP) {
+
+	router, ok := inventory.routerBySource(source.String())
+	if !ok {
+		syslogUnknownTotal.Inc()
+		logger.Debug("message syslog reçu d'une adresse inconnue", "source", source.String())
+		return
+	}
+
+	entry := parseSyslog(data)
+	entry.IP, entry.Username = router.IP, router.Username
+
+	syslogTotal.WithLabelValues(router.IP, router.Username, entry.Severity).Inc()
+	logStore.add(entry, getConfig().Syslog.Buffer)
+}
+
+// Ecoute les messages syslog en UDP.
+// Prend en entrée un contexte (context.Context) dont l'annulation arrête l'écoute et l'adresse d'écoute (string), ne renvoie rien.
+func listenSyslogUDP(ctx context.Context, addr string) {
+
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		logger.Error("écoute syslog UDP impossible", "addr", addr, "error", err)
+		return
+	}
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+	logger.Info("écoute syslog", "addr", addr, "protocol", "udp")
+
+	buf := make([]byte, syslogMaxSize)
+	for {
+		n, remote, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.Error("arrêt de l'écoute syslog UDP", "addr", addr, "error", err)
+			}
+			return
+		}
+		if udpAddr, ok := remote.(*net.UDPAddr); ok {
+			handleSyslog(slices.Clone(buf[:n]), udpAddr.IP)
+		}
+	}
+}
+
+// Ecoute les messages syslog en TCP.
+// Prend en entrée un contexte (context.Context) dont l'annulation arrête l'écoute et la configuration syslog (SyslogConfig), ne renvoie rien.
+// Au-delà de max_connections connexions simultanées, les nouvelles connexions sont refusées.
+func listenSyslogTCP(ctx context.Context, conf SyslogConfig) {
+
+	addr := conf.TCP
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		logger.Error("écoute syslog TCP impossible", "addr", addr, "error", err)
+		return
+	}
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+	logger.Info("écoute syslog", "addr", addr, "protocol", "tcp", "max_connections", conf.MaxConnections)
+
+	slots := make(chan struct{}, max(conf.MaxConnections, 1))
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.Error("arrêt de l'écoute syslog TCP", "addr", addr, "error", err)
+			}
+			return
+		}
+
+		select {
+		case slots <- struct{}{}:
+			go func() {
+				defer func() { <-slots }()
+				readSyslogStream(ctx, conn, time.Duration(conf.Timeout))
+			}()
+		default:
+			logger.Debug("connexion syslog refusée, nombre maximum de connexions atteint", "source", conn.RemoteAddr().String())
+			conn.Close()
+		}
+	}
+}
+
+// Erreur renvoyée pour une trame TCP dont le préfixe de longueur est invalide.
+var errSyslogFrame = errors.New("trame syslog invalide")
+
+// Lit le message suivant d'un flux syslog TCP.
+// Prend en entrée le flux (*bufio.Reader, d'au moins syslogMaxSize octets) et renvoie le message ([]byte) ou une erreur
+// (io.EOF en fin de flux, errSyslogFrame pour un préfixe de longueur invalide ou plus long que le tampon).
+// Les deux découpages de la RFC 6587 sont acceptés: préfixe de longueur ("123 <30>...") ou un message par ligne.
+// Une ligne plus longue que syslogMaxSize est tronquée et sa suite ignorée, pour ne pas la découper en plusieurs messages.
+func readSyslogFrame(reader *bufio.Reader) ([]byte, error) {
+
+	first, err := reader.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+
+	// Préfixe de longueur, limité à la taille du tampon pour qu'un préfixe sans fin ne soit pas gardé en mémoire
+	if first[0] >= '0' && first[0] <= '9' {
+		prefix, err := reader.ReadSlice(' ')
+		if errors.Is(err, bufio.ErrBufferFull) {
+			return nil, errSyslogFrame
+		}
+		if err != nil {
+			return nil, err
+		}
+		length, err := strconv.Atoi(strings.TrimSpace(string(prefix)))
+		if err != nil || length <= 0 || length > syslogMaxSize {
+			return nil, errSyslogFrame
+		}
+		msg := make([]byte, length)
+		_, err = io.ReadFull(reader, msg)
+		if err != nil {
+			return nil, err
+		}
+		return msg, nil
+	}
+
+	// Un message par ligne
+	line, err := reader.ReadSlice('\n')
+	msg := slices.Clone(line)
+	for errors.Is(err, bufio.ErrBufferFull) {
+		_, err = reader.ReadSlice('\n')
+	}
+	if errors.Is(err, io.EOF) && len(msg) > 0 {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+// Lit les messages syslog d'une connexion TCP jusqu'à sa fermeture.
+// Prend en entrée un contexte (context.Context) dont l'annulation ferme la connexion, la connexion (net.Conn)
+// et le délai maximum de réception d'un message (time.Duration), ne renvoie rien.
+func readSyslogStream(ctx context.Context, conn net.Conn, timeout time.Duration) {
+
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	source := conn.RemoteAddr().(*net.TCPAddr).IP
+	reader := bufio.NewReaderSize(conn, syslogMaxSize)
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		msg, err := readSyslogFrame(reader)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && ctx.Err() == nil {
+				logger.Debug("connexion syslog fermée", "source", source.String(), "error", err)
+			}
+			return
+		}
+
+		if len(strings.TrimSpace(string(msg))) > 0 {
+			handleSyslog(msg, source)
+		}
+	}
+}
+
+// Démarre l'écoute syslog (UDP et/ou TCP) si elle est activée.
+// Prend en entrée un contexte (context.Context) dont l'annulation arrête l'écoute, et ne renvoie rien.
+// Les adresses d'écoute ne sont lues qu'au démarrage.
+func listenSyslog(ctx context.Context) {
+
+	conf := getConfig().Syslog
+	if !conf.Enabled {
+		return
+	}
+
+	if conf.UDP != "" {
+		go listenSyslogUDP(ctx, conf.UDP)
+	}
+	if conf.TCP != "" {
+		go listenSyslogTCP(ctx, conf)
+	}
+
+	// Oubli régulier des messages des routeurs supprimés de l'inventaire
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Minute * 10):
+			logStore.prune(inventory.snapshot())
+		}
+	}
+}
+
+// Traite les requêtes HTTP GET sur /api/v1/routers/{ip}/logs.
+// Renvoie les derniers messages syslog du routeur, du plus récent au plus ancien, si l'utilisateur (paramètre user) y a accès.
+// Filtres optionnels: q (texte recherché, insensible à la casse), severity (niveau minimum, ex: warning), app, since (date RFC 3339 ou durée, ex: 1h) et limit.
+// Prend en entrée un http.responseWriter et un pointeur *http.Request.
+func getLogs(writer http.ResponseWriter, request *http.Request) {
+
+	ip, ok := requestRouter(writer, request)
+	if !ok {
+		return
+	}
+	query := request.URL.Query()
+
+	// Filtres
+	search := strings.ToLower(query.Get("q"))
+	app := query.Get("app")
+	maxSeverity := len(syslogSeverities) - 1
+	if s := query.Get("severity"); s != "" {
+		maxSeverity = slices.Index(syslogSeverities, strings.ToLower(s))
+		if maxSeverity < 0 {
+			http.Error(writer, "severity invalide (emerg, alert, crit, err, warning, notice, info, debug)", http.StatusBadRequest)
+			return
+		}
+	}
+	var since time.Time
+	if s := query.Get("since"); s != "" {
+		if d, err := time.ParseDuration(s); err == nil {
+			since = time.Now().Add(-d)
+		} else if t, err := time.Parse(time.RFC3339, s); err == nil {
+			since = t
+		} else {
+			http.Error(writer, "since invalide (date RFC 3339 ou durée)", http.StatusBadRequest)
+			return
+		}
+	}
+	limit, err := strconv.Atoi(query.Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 100
+	}
+
+	entries := logStore.list(ip, func(entry LogEntry) bool {
+		return slices.Index(syslogSeverities, entry.Severity) <= maxSeverity &&
+			(app == "" || entry.App == app) &&
+			!entry.Recu.Before(since) &&
+			(search == "" || strings.Contains(strings.ToLower(entry.Message), search))
+	}, limit)
+
+	writer.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(writer).Encode(entries)
+	if err != nil {
+		requestLogger(request).Warn("erreur lors de l'envoi de la réponse", "ip", ip, "error", err)
+	}
+}
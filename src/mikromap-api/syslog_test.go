@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSyslog(t *testing.T) {
+
+	tests := []struct {
+		name string
+		in   string
+		want LogEntry // Date comparée seulement si renseignée
+	}{
+		{
+			name: "RFC 3164 RouterOS",
+			in:   "<30>Mar  4 10:15:02 MikroTik system,info,account user admin logged in from 10.0.0.5 via ssh",
+			want: LogEntry{Hostname: "MikroTik", Facility: "daemon", Severity: "info", App: "system,info,account", Message: "user admin logged in from 10.0.0.5 via ssh"},
+		},
+		{
+			name: "RFC 3164 avec tag",
+			in:   "<28>Mar  4 10:15:02 fw01 dhcp[12]: lease expired",
+			want: LogEntry{Hostname: "fw01", Facility: "daemon", Severity: "warning", App: "dhcp", Message: "lease expired"},
+		},
+		{
+			name: "RFC 5424",
+			in:   "<11>1 2024-03-04T10:15:02Z routeur1 firewall - - - drop input ether1\n",
+			want: LogEntry{Date: time.Date(2024, 3, 4, 10, 15, 2, 0, time.UTC), Hostname: "routeur1", Facility: "user", Severity: "err", App: "firewall", Message: "drop input ether1"},
+		},
+		{
+			name: "message illisible",
+			in:   "  pas du syslog\n",
+			want: LogEntry{Severity: "notice", Message: "pas du syslog"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseSyslog([]byte(tt.in))
+			if !tt.want.Date.IsZero() && !got.Date.Equal(tt.want.Date) {
+				t.Errorf("date = %v, attendu %v", got.Date, tt.want.Date)
+			}
+			if got.Recu.IsZero() || got.Date.IsZero() {
+				t.Errorf("date de réception ou du message vide: %+v", got)
+			}
+			got.Date, got.Recu, tt.want.Date = time.Time{}, time.Time{}, time.Time{}
+			if got != tt.want {
+				t.Errorf("parseSyslog = %+v, attendu %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadSyslogFrame(t *testing.T) {
+
+	long := strings.Repeat("x", syslogMaxSize+100)
+
+	tests := []struct {
+		name string
+		in   string
+		want []string
+		err  error // Erreur attendue après les messages
+	}{
+		{"lignes", "<30>a\n<30>b\n", []string{"<30>a\n", "<30>b\n"}, io.EOF},
+		{"dernière ligne sans fin", "<30>a\n<30>b", []string{"<30>a\n", "<30>b"}, io.EOF},
+		{"préfixe de longueur", "5 <30>a3 <1>", []string{"<30>a", "<1>"}, io.EOF},
+		{"préfixe et lignes", "5 <30>a<30>b\n", []string{"<30>a", "<30>b\n"}, io.EOF},
+		{"ligne trop longue", long + "\n<30>b\n", []string{long[:syslogMaxSize], "<30>b\n"}, io.EOF},
+		{"ligne trop longue en fin de flux", long, []string{long[:syslogMaxSize]}, io.EOF},
+		{"longueur nulle", "0 <30>a", nil, errSyslogFrame},
+		{"longueur trop grande", "9999 <30>a", nil, errSyslogFrame},
+		{"trame tronquée", "10 <30>a", nil, io.ErrUnexpectedEOF},
+		{"préfixe sans fin", strings.Repeat("9", syslogMaxSize*4), nil, errSyslogFrame},
+		{"préfixe interrompu", "123", nil, io.EOF},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := bufio.NewReaderSize(strings.NewReader(tt.in), syslogMaxSize)
+			var got []string
+			var err error
+			for {
+				var msg []byte
+				msg, err = readSyslogFrame(reader)
+				if err != nil {
+					break
+				}
+				got = append(got, string(msg))
+			}
+			if !errors.Is(err, tt.err) {
+				t.Errorf("erreur = %v, attendu %v", err, tt.err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("%d messages, attendu %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("message %d = %.40q (%d octets), attendu %.40q (%d octets)", i, got[i], len(got[i]), tt.want[i], len(tt.want[i]))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync/atomic"
+)
+
+// Certificats utilisés par le serveur HTTPS.
+// Ils sont relus à chaque SIGHUP, et les nouvelles connexions utilisent immédiatement les nouveaux certificats (pas besoin de redémarrer après un renouvellement).
+type CertStore struct {
+	cert      atomic.Pointer[tls.Certificate]
+	clientCAs atomic.Pointer[x509.CertPool]
+}
+
+// Certificats globaux de l'API.
+var certs CertStore
+
+// Charge le certificat, la clé et la CA des clients.
+// Méthode de *CertStore. Prend en entrée la configuration TLS (TLSConfig) et renvoie une erreur si un fichier est illisible ou invalide,
+// ou si client_ca a été retiré alors que le mTLS est actif (l'authentification n'est pas désactivée sans redémarrage),
+// auquel cas les certificats précédents sont conservés.
+func (store *CertStore) load(conf TLSConfig) error {
+
+	var pool *x509.CertPool
+
+	// Certificat et clé du serveur
+	cert, err := tls.LoadX509KeyPair(confPath(conf.Cert), confPath(conf.Key))
+	if err != nil {
+		return fmt.Errorf("erreur lors du chargement du certificat: %w", err)
+	}
+
+	// CA des clients (mTLS)
+	if conf.ClientCA != "" {
+		content, err := os.ReadFile(confPath(conf.ClientCA))
+		if err != nil {
+			return fmt.Errorf("erreur lors de la lecture de la CA des clients: %w", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(content) {
+			return fmt.Errorf("aucun certificat valide dans %s", conf.ClientCA)
+		}
+	}
+
+	if pool == nil && store.clientCAs.Load() != nil {
+		return fmt.Errorf("client_ca retiré de la configuration: le mTLS reste actif jusqu'au redémarrage de l'API")
+	}
+
+	store.cert.Store(&cert)
+	store.clientCAs.Store(pool)
+
+	return nil
+}
+
+// Renvoie la configuration TLS du serveur.
+// Méthode de *CertStore. Ne prend rien en entrée et renvoie la configuration (*tls.Config).
+// La configuration est recalculée pour chaque connexion, ce qui permet de prendre en compte les certificats rechargés.
+func (store *CertStore) tlsConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"h2", "http/1.1"},
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			conf := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*store.cert.Load()},
+				NextProtos:   []string{"h2", "http/1.1"},
+			}
+			if pool := store.clientCAs.Load(); pool != nil {
+				conf.ClientCAs = pool
+				conf.ClientAuth = tls.RequireAndVerifyClientCert
+			}
+			return conf, nil
+		},
+	}
+}
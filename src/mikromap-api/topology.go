@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+)
+
+// Statuts possibles d'un routeur (champ Statut).
+const (
+	statutDown        = 0
+	statutUp          = 1
+	statutInjoignable = 2 // Le routeur est derrière un parent down, son état réel est inconnu.
+)
+
+// Graphe de dépendances entre routeurs.
+// Un routeur dont le champ Parent est renseigné n'est joignable qu'à travers ce parent (ex: site client derrière le routeur du siège).
+type Topology struct {
+	parents  map[string]string   // IP du routeur -> IP de son parent
+	children map[string][]string // IP du routeur -> IPs de ses enfants directs
+}
+
+// Construit le graphe de dépendances à partir des routeurs.
+// Prend en entrée les routeurs ([]Router) et renvoie le graphe (Topology) ainsi que les erreurs rencontrées ([]error).
+// Les liens invalides (parent inconnu, routeur parent de lui-même, cycle) sont ignorés et signalés, les routeurs concernés sont alors traités comme des racines.
+func buildTopology(routers []Router) (Topology, []error) {
+
+	var errs []error
+
+	topo := Topology{
+		parents:  make(map[string]string),
+		children: make(map[string][]string),
+	}
+
+	// Index des IPs connues
+	known := make(map[string]bool)
+	for _, v := range routers {
+		known[v.IP] = true
+	}
+
+	// Ajout des liens parent -> enfant
+	for _, v := range routers {
+		if v.Parent == "" {
+			continue
+		}
+		if v.Parent == v.IP {
+			errs = append(errs, fmt.Errorf("le routeur %s est déclaré comme son propre parent", v.IP))
+			continue
+		}
+		if !known[v.Parent] {
+			errs = append(errs, fmt.Errorf("le parent %s du routeur %s n'existe pas", v.Parent, v.IP))
+			continue
+		}
+		topo.parents[v.IP] = v.Parent
+	}
+
+	// Détection des cycles: on remonte les parents de chaque routeur, et si on repasse par le routeur de départ, on coupe le lien.
+	// Un routeur dont les ancêtres bouclent sans repasser par lui (enfant d'un cycle) garde son parent:
+	// le cycle est coupé quand on remonte depuis l'un de ses membres.
+	for _, v := range routers {
+		seen := map[string]bool{v.IP: true}
+		for p, ok := topo.parents[v.IP]; ok; p, ok = topo.parents[p] {
+			if p == v.IP {
+				errs = append(errs, fmt.Errorf("cycle détecté dans les parents du routeur %s", v.IP))
+				delete(topo.parents, v.IP)
+				break
+			}
+			if seen[p] {
+				break
+			}
+			seen[p] = true
+		}
+	}
+
+	// Index inverse
+	for _, v := range routers {
+		if p, ok := topo.parents[v.IP]; ok {
+			topo.children[p] = append(topo.children[p], v.IP)
+		}
+	}
+
+	return topo, errs
+}
+
+// Renvoie les ancêtres d'un routeur, du parent direct jusqu'à la racine.
+// Méthode de Topology. Prend en entrée l'IP du routeur (string) et renvoie les IPs des ancêtres ([]string).
+func (topo Topology) ancestors(ip string) []string {
+
+	var res []string
+
+	for p, ok := topo.parents[ip]; ok; p, ok = topo.parents[p] {
+		res = append(res, p)
+	}
+
+	return res
+}
+
+// Renvoie tous les descendants d'un routeur (enfants, petits-enfants, etc.).
+// Méthode de Topology. Prend en entrée l'IP du routeur (string) et renvoie les IPs des descendants ([]string).
+func (topo Topology) descendants(ip string) []string {
+
+	var res []string
+
+	for _, c := range topo.children[ip] {
+		res = append(res, c)
+		res = append(res, topo.descendants(c)...)
+	}
+
+	return res
+}
+
+// Corrige les statuts mesurés en fonction de la topologie.
+// Un routeur down dont un ancêtre est down n'est pas une panne indépendante: il passe en statut injoignable
+// et son champ Cause reçoit l'IP de l'ancêtre down le plus haut (la cause racine).
+// Prend en entrée le graphe (Topology) et les routeurs ([]Router, modifiés en place), ne renvoie rien.
+func (topo Topology) applyStatus(routers []Router) {
+
+	// Statuts mesurés par le ping, avant correction
+	measured := make(map[string]int)
+	for _, v := range routers {
+		measured[v.IP] = v.Statut
+	}
+
+	for i := range routers {
+		routers[i].Cause = ""
+		if routers[i].Statut != statutDown {
+			continue
+		}
+
+		// On garde l'ancêtre down le plus proche de la racine.
+		for _, p := range topo.ancestors(routers[i].IP) {
+			if measured[p] == statutDown {
+				routers[i].Cause = p
+			}
+		}
+		if routers[i].Cause != "" {
+			routers[i].Statut = statutInjoignable
+		}
+	}
+}
+
+// Signale les changements d'état entre deux passes de ping.
+// Seules les causes racines lèvent une alerte: un routeur qui devient injoignable à cause de son parent est simplement mentionné.
+// Méthode de Topology. Prend en entrée les statuts précédents (map IP -> statut) et les routeurs après correction ([]Router), ne renvoie rien.
+func (topo Topology) notifyStateChanges(previous map[string]int, routers []Router) {
+
+	for _, v := range routers {
+		old, ok := previous[v.IP]
+		if ok && old == v.Statut {
+			continue
+		}
+
+		switch v.Statut {
+		case statutDown:
+			alertStateChange(v, len(topo.descendants(v.IP)))
+		case statutUp:
+			// Seul un routeur qui avait levé une alerte donne lieu à une alerte de rétablissement.
+			if ok && old == statutDown {
+				alertStateChange(v, 0)
+			} else if ok && old == statutInjoignable {
+				routerLogger(v).Info("routeur de nouveau joignable")
+			}
+		case statutInjoignable:
+			routerLogger(v).Info("routeur injoignable", "cause", v.Cause)
+		}
+	}
+}
+
+// Lève une alerte pour un changement d'état d'un routeur.
+// Prend en entrée le routeur (Router) et le nombre de routeurs en aval (int), ne renvoie rien.
+func alertStateChange(router Router, downstream int) {
+
+	if router.Statut == statutDown {
+		routerLogger(router).Error("ALERTE: routeur down", "alert", true, "downstream", downstream)
+		return
+	}
+	routerLogger(router).Warn("ALERTE: routeur rétabli", "alert", true)
+}
+
+// Lève une alerte pour un trap SNMP (ex: interface down), par le même canal que les changements d'état.
+// Prend en entrée le routeur (Router) et le trap (TrapEvent), ne renvoie rien.
+func alertTrap(router Router, event TrapEvent) {
+
+	switch event.Trap {
+	case "linkDown":
+		routerLogger(router).Error("ALERTE: interface down", "alert", true, "trap", event.Trap, "interface", event.Interface)
+	case "linkUp":
+		routerLogger(router).Warn("ALERTE: interface rétablie", "alert", true, "trap", event.Trap, "interface", event.Interface)
+	default:
+		routerLogger(router).Warn("ALERTE: trap SNMP", "alert", true, "trap", event.Trap, "interface", event.Interface)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestBuildTopology(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		routers []Router
+		parents map[string]string // Liens gardés
+		errs    int
+	}{
+		{
+			name:    "chaîne",
+			routers: []Router{{IP: "a"}, {IP: "b", Parent: "a"}, {IP: "c", Parent: "b"}},
+			parents: map[string]string{"b": "a", "c": "b"},
+		},
+		{
+			name:    "parent inconnu",
+			routers: []Router{{IP: "a", Parent: "x"}},
+			parents: map[string]string{},
+			errs:    1,
+		},
+		{
+			name:    "propre parent",
+			routers: []Router{{IP: "a", Parent: "a"}, {IP: "b", Parent: "a"}},
+			parents: map[string]string{"b": "a"},
+			errs:    1,
+		},
+		{
+			name:    "cycle de deux routeurs",
+			routers: []Router{{IP: "a", Parent: "b"}, {IP: "b", Parent: "a"}},
+			parents: map[string]string{"b": "a"},
+			errs:    1,
+		},
+		{
+			name:    "enfant d'un cycle",
+			routers: []Router{{IP: "v", Parent: "a"}, {IP: "a", Parent: "b"}, {IP: "b", Parent: "a"}},
+			parents: map[string]string{"v": "a", "b": "a"},
+			errs:    1,
+		},
+		{
+			name:    "cycle de trois routeurs",
+			routers: []Router{{IP: "a", Parent: "c"}, {IP: "b", Parent: "a"}, {IP: "c", Parent: "b"}},
+			parents: map[string]string{"b": "a", "c": "b"},
+			errs:    1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			topo, errs := buildTopology(tt.routers)
+			if len(errs) != tt.errs {
+				t.Errorf("erreurs = %v, attendu %d", errs, tt.errs)
+			}
+			if !maps.Equal(topo.parents, tt.parents) {
+				t.Errorf("parents = %v, attendu %v", topo.parents, tt.parents)
+			}
+		})
+	}
+}
+
+func TestApplyStatus(t *testing.T) {
+
+	routers := []Router{
+		{IP: "siege", Statut: statutDown},
+		{IP: "site", Parent: "siege", Statut: statutDown},
+		{IP: "client", Parent: "site", Statut: statutDown},
+		{IP: "autre", Parent: "siege", Statut: statutUp},
+		{IP: "seul", Statut: statutDown},
+	}
+	topo, _ := buildTopology(routers)
+	topo.applyStatus(routers)
+
+	want := map[string][2]any{
+		"siege":  {statutDown, ""},
+		"site":   {statutInjoignable, "siege"},
+		"client": {statutInjoignable, "siege"},
+		"autre":  {statutUp, ""},
+		"seul":   {statutDown, ""},
+	}
+	for _, v := range routers {
+		if got := [2]any{v.Statut, v.Cause}; got != want[v.IP] {
+			t.Errorf("%s: statut, cause = %v, attendu %v", v.IP, got, want[v.IP])
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+// OID de snmpTrapOID.0, qui contient le type des traps v2c.
+const oidSnmpTrapOID = ".1.3.6.1.6.3.1.1.4.1.0"
+
+// Noms des traps génériques (RFC 1157 pour v1, RFC 3418 pour v2c).
+var genericTraps = []string{"coldStart", "warmStart", "linkDown", "linkUp", "authenticationFailure", "egpNeighborLoss"}
+
+// Préfixes des OID contenant le nom d'une interface (ifDescr, ifName), pour les traps linkDown et linkUp.
+var oidInterfaceNames = []string{".1.3.6.1.2.1.2.2.1.2.", ".1.3.6.1.2.1.31.1.1.1.1."}
+
+// Trap SNMP reçu.
+type TrapEvent struct {
+	Date      time.Time      `json:"date"`
+	Source    string         `json:"source"`   // Adresse d'origine du trap
+	IP        string         `json:"ip"`       // IP du routeur correspondant dans routers.json, vide si inconnu
+	Username  string         `json:"username"` // Utilisateur Grafana principal du routeur
+	Version   string         `json:"version"`  // v1 ou v2c
+	Trap      string         `json:"trap"`     // Nom du trap générique (ex: linkDown) ou OID du trap
+	Interface string         `json:"interface,omitempty"`
+	Variables []TrapVariable `json:"variables"`
+}
+
+// Variable transmise avec un trap.
+type TrapVariable struct {
+	OID   string `json:"oid"`
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// Derniers traps reçus, dans l'ordre d'arrivée.
+// Le nombre de traps conservés est limité (traps.buffer dans mikromap.json), les plus anciens sont oubliés.
+type TrapBuffer struct {
+	mu     sync.RWMutex
+	events []TrapEvent
+}
+
+// Traps reçus par l'API.
+var trapBuffer TrapBuffer
+
+// Ajoute un trap au tampon.
+// Méthode de *TrapBuffer. Prend en entrée le trap (TrapEvent) et la taille maximale du tampon (int), ne renvoie rien.
+func (buf *TrapBuffer) add(event TrapEvent, size int) {
+
+	buf.mu.Lock()
+	defer buf.mu.Unlock()
+
+	buf.events = append(buf.events, event)
+	if len(buf.events) > size {
+		buf.events = slices.Delete(buf.events, 0, len(buf.events)-size)
+	}
+}
+
+// Renvoie les traps du tampon, du plus récent au plus ancien.
+// Méthode de *TrapBuffer. Prend en entrée une fonction de filtre (func(TrapEvent) bool) et le nombre maximum de traps (int),
+// renvoie les traps retenus ([]TrapEvent).
+func (buf *TrapBuffer) list(keep func(TrapEvent) bool, limit int) []TrapEvent {
+
+	buf.mu.RLock()
+	defer buf.mu.RUnlock()
+
+	res := []TrapEvent{}
+	for i := len(buf.events) - 1; i >= 0 && len(res) < limit; i-- {
+		if keep(buf.events[i]) {
+			res = append(res, buf.events[i])
+		}
+	}
+
+	return res
+}
+
+// Convertit la valeur d'une variable SNMP en texte.
+// Prend en entrée la variable (gosnmp.SnmpPDU) et renvoie sa valeur (string).
+func snmpValue(pdu gosnmp.SnmpPDU) string {
+
+	switch v := pdu.Value.(type) {
+	case []byte:
+		return string(v)
+	case string:
+		return v
+	case nil:
+		return ""
+	default:
+		if pdu.Type == gosnmp.IPAddress || pdu.Type == gosnmp.ObjectIdentifier {
+			return fmt.Sprint(v)
+		}
+		return gosnmp.ToBigInt(v).String()
+	}
+}
+
+// Décode un trap reçu.
+// Prend en entrée le paquet (*gosnmp.SnmpPacket) et l'adresse d'origine (*net.UDPAddr), renvoie le trap (TrapEvent).
+func decodeTrap(packet *gosnmp.SnmpPacket, addr *net.UDPAddr) TrapEvent {
+
+	event := TrapEvent{Date: time.Now(), Source: addr.IP.String(), Variables: []TrapVariable{}}
+
+	// Type du trap
+	switch packet.Version {
+	case gosnmp.Version1:
+		event.Version = "v1"
+		if packet.GenericTrap >= 0 && packet.GenericTrap < len(genericTraps) {
+			event.Trap = genericTraps[packet.GenericTrap]
+		} else {
+			event.Trap = strings.TrimSuffix(packet.Enterprise, ".") + ".0." + strconv.Itoa(packet.SpecificTrap)
+		}
+	default:
+		event.Version = "v2c"
+	}
+
+	for _, v := range packet.Variables {
+		value := snmpValue(v)
+		if v.Name == oidSnmpTrapOID {
+			event.Trap = value
+			if suffix, ok := strings.CutPrefix(value, ".1.3.6.1.6.3.1.1.5."); ok {
+				if n, err := strconv.Atoi(suffix); err == nil && n >= 1 && n <= len(genericTraps) {
+					event.Trap = genericTraps[n-1]
+				}
+			}
+			continue
+		}
+		for _, prefix := range oidInterfaceNames {
+			if strings.HasPrefix(v.Name, prefix) {
+				event.Interface = value
+			}
+		}
+		event.Variables = append(event.Variables, TrapVariable{OID: v.Name, Type: v.Type.String(), Value: value})
+	}
+
+	return event
+}
+
+// Traite un trap reçu: vérification de la communauté, rattachement à un routeur, enregistrement, métriques et alerte.
+// Prend en entrée le paquet (*gosnmp.SnmpPacket) et l'adresse d'origine (*net.UDPAddr), ne renvoie rien.
+func handleTrap(packet *gosnmp.SnmpPacket, addr *net.UDPAddr) {
+
+	conf := getConfig().Traps
+
+	if len(conf.Communities) > 0 && !slices.Contains(conf.Communities, packet.Community) {
+		trapsRejectedTotal.Inc()
+		logger.Debug("trap SNMP ignoré, communauté non autorisée", "source", addr.IP.String())
+		return
+	}
+
+	event := decodeTrap(packet, addr)
+
+	router, ok := inventory.routerBySource(event.Source)
+	if !ok && packet.Version == gosnmp.Version1 && packet.AgentAddress != "" {
+		router, ok = inventory.routerBySource(packet.AgentAddress)
+	}
+	if !ok {
+		trapsUnknownTotal.Inc()
+		trapBuffer.add(event, conf.Buffer)
+		logger.Warn("trap SNMP reçu d'une adresse inconnue", "source", event.Source, "trap", event.Trap)
+		return
+	}
+
+	event.IP, event.Username = router.IP, router.Username
+	trapsTotal.WithLabelValues(router.IP, router.Username, event.Trap).Inc()
+	trapBuffer.add(event, conf.Buffer)
+
+	if slices.Contains(conf.Alert, event.Trap) {
+		alertTrap(router, event)
+	} else {
+		routerLogger(router).Info("trap SNMP reçu", "trap", event.Trap, "interface", event.Interface)
+	}
+}
+
+// Ecoute les traps SNMP.
+// Prend en entrée un contexte (context.Context) dont l'annulation arrête l'écoute, et ne renvoie rien.
+// L'adresse d'écoute n'est lue qu'au démarrage, le reste de la configuration est relu à chaque trap.
+func listenTraps(ctx context.Context) {
+
+	conf := getConfig().Traps
+	if !conf.Enabled {
+		return
+	}
+
+	listener := gosnmp.NewTrapListener()
+	listener.OnNewTrap = handleTrap
+	listener.Params = gosnmp.Default
+
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	logger.Info("écoute des traps SNMP", "addr", conf.Listen)
+	err := listener.Listen(conf.Listen)
+	if err != nil && ctx.Err() == nil {
+		logger.Error("écoute des traps SNMP impossible", "addr", conf.Listen, "error", err)
+	}
+}
+
+// Traite les requêtes HTTP GET sur /api/v1/traps.
+// Renvoie les derniers traps reçus des routeurs visibles par l'utilisateur (paramètre user), du plus récent au plus ancien.
+// Les traps d'adresses inconnues ne sont renvoyés qu'à admin. Les paramètres ip, trap et limit permettent de filtrer.
+// Prend en entrée un http.responseWriter et un pointeur *http.Request.
+func getTraps(writer http.ResponseWriter, request *http.Request) {
+
+	query := request.URL.Query()
+	user := query.Get("user")
+
+	// Routeurs visibles
+	visible := make(map[string]bool)
+	for _, v := range visibleRouters(user) {
+		visible[v.IP] = true
+	}
+	admin := user == "admin"
+
+	limit, err := strconv.Atoi(query.Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 100
+	}
+
+	events := trapBuffer.list(func(event TrapEvent) bool {
+		if event.IP == "" && !admin || event.IP != "" && !visible[event.IP] {
+			return false
+		}
+		if ip := query.Get("ip"); ip != "" && event.IP != ip {
+			return false
+		}
+		if trap := query.Get("trap"); trap != "" && event.Trap != trap {
+			return false
+		}
+		return true
+	}, limit)
+
+	writer.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(writer).Encode(events)
+	if err != nil {
+		requestLogger(request).Warn("erreur lors de l'envoi de la réponse", "username", user, "error", err)
+	}
+}
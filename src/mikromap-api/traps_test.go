@@ -0,0 +1,122 @@
+package main
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+func TestDecodeTrap(t *testing.T) {
+
+	addr := &net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: 162}
+	ifName := gosnmp.SnmpPDU{Name: ".1.3.6.1.2.1.31.1.1.1.1.3", Type: gosnmp.OctetString, Value: []byte("ether3")}
+	ifIndex := gosnmp.SnmpPDU{Name: ".1.3.6.1.2.1.2.2.1.1.3", Type: gosnmp.Integer, Value: 3}
+	trapOID := func(oid string) gosnmp.SnmpPDU {
+		return gosnmp.SnmpPDU{Name: oidSnmpTrapOID, Type: gosnmp.ObjectIdentifier, Value: oid}
+	}
+
+	tests := []struct {
+		name      string
+		packet    gosnmp.SnmpPacket
+		version   string
+		trap      string
+		iface     string
+		variables []TrapVariable
+	}{
+		{
+			name:      "v1 générique",
+			packet:    gosnmp.SnmpPacket{Version: gosnmp.Version1, Variables: []gosnmp.SnmpPDU{ifIndex, ifName}, SnmpTrap: gosnmp.SnmpTrap{GenericTrap: 2}},
+			version:   "v1",
+			trap:      "linkDown",
+			iface:     "ether3",
+			variables: []TrapVariable{{".1.3.6.1.2.1.2.2.1.1.3", "Integer", "3"}, {".1.3.6.1.2.1.31.1.1.1.1.3", "OctetString", "ether3"}},
+		},
+		{
+			name:      "v1 spécifique",
+			packet:    gosnmp.SnmpPacket{Version: gosnmp.Version1, SnmpTrap: gosnmp.SnmpTrap{GenericTrap: 6, Enterprise: ".1.3.6.1.4.1.14988.", SpecificTrap: 5}},
+			version:   "v1",
+			trap:      ".1.3.6.1.4.1.14988.0.5",
+			variables: []TrapVariable{},
+		},
+		{
+			name:      "v2c générique",
+			packet:    gosnmp.SnmpPacket{Version: gosnmp.Version2c, Variables: []gosnmp.SnmpPDU{trapOID(".1.3.6.1.6.3.1.1.5.4"), ifName}},
+			version:   "v2c",
+			trap:      "linkUp",
+			iface:     "ether3",
+			variables: []TrapVariable{{".1.3.6.1.2.1.31.1.1.1.1.3", "OctetString", "ether3"}},
+		},
+		{
+			name:      "v2c spécifique",
+			packet:    gosnmp.SnmpPacket{Version: gosnmp.Version2c, Variables: []gosnmp.SnmpPDU{trapOID(".1.3.6.1.4.1.14988.1.0.1")}},
+			version:   "v2c",
+			trap:      ".1.3.6.1.4.1.14988.1.0.1",
+			variables: []TrapVariable{},
+		},
+		{
+			name:      "v2c numéro générique hors limites",
+			packet:    gosnmp.SnmpPacket{Version: gosnmp.Version2c, Variables: []gosnmp.SnmpPDU{trapOID(".1.3.6.1.6.3.1.1.5.9")}},
+			version:   "v2c",
+			trap:      ".1.3.6.1.6.3.1.1.5.9",
+			variables: []TrapVariable{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := decodeTrap(&tt.packet, addr)
+			if event.Source != "10.0.0.1" || event.Version != tt.version || event.Trap != tt.trap || event.Interface != tt.iface {
+				t.Errorf("source, version, trap, interface = %s, %s, %s, %s, attendu 10.0.0.1, %s, %s, %s",
+					event.Source, event.Version, event.Trap, event.Interface, tt.version, tt.trap, tt.iface)
+			}
+			if !reflect.DeepEqual(event.Variables, tt.variables) {
+				t.Errorf("variables = %+v, attendu %+v", event.Variables, tt.variables)
+			}
+		})
+	}
+}
+
+func TestSnmpValue(t *testing.T) {
+
+	tests := []struct {
+		pdu  gosnmp.SnmpPDU
+		want string
+	}{
+		{gosnmp.SnmpPDU{Type: gosnmp.OctetString, Value: []byte("texte")}, "texte"},
+		{gosnmp.SnmpPDU{Type: gosnmp.ObjectIdentifier, Value: ".1.3.6"}, ".1.3.6"},
+		{gosnmp.SnmpPDU{Type: gosnmp.IPAddress, Value: "10.0.0.1"}, "10.0.0.1"},
+		{gosnmp.SnmpPDU{Type: gosnmp.Integer, Value: -5}, "-5"},
+		{gosnmp.SnmpPDU{Type: gosnmp.Counter64, Value: uint64(18446744073709551615)}, "18446744073709551615"},
+		{gosnmp.SnmpPDU{Type: gosnmp.TimeTicks, Value: uint32(4200)}, "4200"},
+		{gosnmp.SnmpPDU{Type: gosnmp.Null}, ""},
+	}
+
+	for _, tt := range tests {
+		if got := snmpValue(tt.pdu); got != tt.want {
+			t.Errorf("snmpValue(%v) = %q, attendu %q", tt.pdu.Value, got, tt.want)
+		}
+	}
+}
+
+func TestTrapBuffer(t *testing.T) {
+
+	var buf TrapBuffer
+	for _, trap := range []string{"coldStart", "linkDown", "linkUp", "linkDown"} {
+		buf.add(TrapEvent{Trap: trap}, 3)
+	}
+
+	var got []string
+	for _, v := range buf.list(func(TrapEvent) bool { return true }, 10) {
+		got = append(got, v.Trap)
+	}
+	if want := []string{"linkDown", "linkUp", "linkDown"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("list = %v, attendu %v", got, want)
+	}
+
+	res := buf.list(func(event TrapEvent) bool { return event.Trap == "linkDown" }, 1)
+	if len(res) != 1 || res[0].Trap != "linkDown" {
+		t.Errorf("list filtré = %+v, attendu un seul linkDown", res)
+	}
+}
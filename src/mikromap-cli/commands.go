@@ -0,0 +1,403 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pborman/getopt/v2"
+)
+
+// Codes de sortie de mikromap-cli.
+const (
+	exitOK       = 0
+	exitError    = 1 // Erreur d'exécution (fichier illisible, API injoignable...)
+	exitUsage    = 2 // Sous-commande, options ou saisie invalides
+	exitNotFound = 3 // Routeur absent de routers.json
+	exitExists   = 4 // Routeur déjà présent dans routers.json
+	exitImport   = 5 // Import incomplet: au moins une ligne rejetée
+)
+
+var (
+	errUsage    = errors.New("utilisation invalide")
+	errNotFound = errors.New("routeur introuvable")
+	errExists   = errors.New("routeur déjà présent")
+	errImport   = errors.New("import incomplet")
+	errHelp     = errors.New("aide demandée")
+)
+
+// Options globales, passées avant la sous-commande et utilisées comme valeurs par défaut par celles-ci.
+type Options struct {
+	Pass      string // Mot de passe administrateur Grafana
+	GrafanaIP string // IP:port de Grafana
+	APIURL    string // URL de mikromap-api
+	APIToken  string // Jeton d'accès à mikromap-api
+}
+
+// Sous-commande de mikromap-cli.
+type Command struct {
+	Name        string
+	Description string
+	Run         func(opts *Options, args []string) error // args[0] est le nom de la sous-commande
+}
+
+// Sous-commandes disponibles, dans l'ordre d'affichage de l'aide.
+var commands = []Command{
+	{"add", "Ajouter un routeur (invite interactive si --ip est absent)", cmdAdd},
+	{"remove", "Retirer un routeur (invite interactive si --ip est absent)", cmdRemove},
+	{"list", "Lister les routeurs", cmdList},
+	{"show", "Afficher le détail d'un routeur", cmdShow},
+	{"edit", "Modifier un routeur", cmdEdit},
+	{"import", "Importer des routeurs depuis un fichier CSV ou JSON", cmdImport},
+	{"export", "Exporter l'inventaire en CSV, JSON ou XLSX", cmdExport},
+	{"regeocode", "Géocoder à nouveau les adresses de l'inventaire", cmdRegeocode},
+	{"users", "Créer les utilisateurs Grafana (users sync)", cmdUsers},
+	{"compliance", "Afficher le rapport de conformité RouterOS", cmdCompliance},
+}
+
+// Affiche l'aide générale (options globales et sous-commandes) sur la sortie d'erreur.
+// Ne prend rien en entrée et ne renvoie rien.
+func usage() {
+
+	getopt.PrintUsage(os.Stderr)
+	fmt.Fprintln(os.Stderr, "\nSous-commandes (mikromap-cli [commande] --help pour le détail):")
+	w := tabwriter.NewWriter(os.Stderr, 0, 0, 2, ' ', 0)
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %s\t%s\n", c.Name, c.Description)
+	}
+	w.Flush()
+	fmt.Fprintln(os.Stderr, "\nSans sous-commande, -n ajoute (ou supprime) des routeurs avec l'invite interactive.")
+}
+
+// Exécute une sous-commande.
+// Prend en entrée les options globales (*Options) et les arguments restants ([]string, args[0] est le nom de la sous-commande),
+// renvoie l'erreur de la sous-commande.
+func runCommand(opts *Options, args []string) error {
+
+	for _, c := range commands {
+		if c.Name == args[0] {
+			return c.Run(opts, args)
+		}
+	}
+
+	usage()
+	return fmt.Errorf("%w: sous-commande inconnue '%s'", errUsage, args[0])
+}
+
+// Termine le programme avec le code de sortie correspondant à une erreur, après l'avoir journalisée.
+// Prend en entrée l'erreur (nil en cas de succès) et ne renvoie rien.
+func exit(err error) {
+
+	code := exitError
+	switch {
+	case err == nil, errors.Is(err, errHelp):
+		os.Exit(exitOK)
+	case errors.Is(err, errUsage):
+		code = exitUsage
+	case errors.Is(err, errNotFound):
+		code = exitNotFound
+	case errors.Is(err, errExists):
+		code = exitExists
+	case errors.Is(err, errImport):
+		code = exitImport
+	}
+
+	logger.Error(err.Error(), "exit", code)
+	os.Exit(code)
+}
+
+// Crée le jeu d'options d'une sous-commande.
+// Prend en entrée le nom de la sous-commande (string) et ses paramètres positionnels pour l'aide (string), renvoie le jeu d'options (*getopt.Set).
+func newFlagSet(name string, parameters string) *getopt.Set {
+
+	set := getopt.New()
+	set.SetProgram("mikromap-cli " + name)
+	set.SetParameters(parameters)
+	set.BoolLong("help", 'h', "Afficher l'aide de la sous-commande.")
+
+	return set
+}
+
+// Analyse les options d'une sous-commande. Les options peuvent être placées avant ou après les paramètres positionnels.
+// Prend en entrée le jeu d'options (*getopt.Set), les arguments ([]string) et le nombre maximum de paramètres positionnels (int),
+// renvoie les paramètres positionnels ([]string), errHelp si l'aide a été demandée ou une erreur (errUsage) si les options sont invalides.
+func parseFlags(set *getopt.Set, args []string, maxArgs int) ([]string, error) {
+
+	var positional []string
+	err := set.Getopt(args, nil)
+	for err == nil && set.NArgs() > 0 {
+		if set.State() == getopt.DashDash {
+			positional = append(positional, set.Args()...)
+			break
+		}
+		positional = append(positional, set.Arg(0))
+		err = set.Getopt(append([]string{args[0]}, set.Args()[1:]...), nil)
+	}
+	if err == nil && len(positional) > maxArgs {
+		err = fmt.Errorf("argument inattendu '%s'", positional[maxArgs])
+	}
+	if err != nil {
+		set.PrintUsage(os.Stderr)
+		return nil, fmt.Errorf("%w: %v", errUsage, err)
+	}
+	if set.IsSet("help") {
+		set.PrintUsage(os.Stdout)
+		return nil, errHelp
+	}
+
+	return positional, nil
+}
+
+// Vérifie que l'invite interactive peut être utilisée pour compléter une option obligatoire absente.
+// Prend en entrée le nom de l'option (string) et renvoie une erreur (errUsage) si l'entrée standard n'est pas un terminal.
+func requirePrompt(option string) error {
+
+	if !interactive() {
+		return fmt.Errorf("%w: l'option --%s est obligatoire hors d'un terminal", errUsage, option)
+	}
+
+	return nil
+}
+
+// Vérifie que des modifications pourront être confirmées avant d'être écrites.
+// Prend en entrée si --yes ou --dry-run a été donné (bool) et renvoie une erreur (errUsage) hors d'un terminal sans l'une de ces options.
+func requireConfirm(confirmed bool) error {
+
+	if !confirmed && !interactive() {
+		return fmt.Errorf("%w: confirmation impossible hors d'un terminal, utiliser --yes (ou --dry-run)", errUsage)
+	}
+
+	return nil
+}
+
+// Ajoute un routeur et écrit les fichiers.
+// Prend en entrée la saisie (RouterInput) et renvoie une erreur.
+func saveNewRouter(input RouterInput) error {
+
+	inv := loadInventory()
+	router, err := inv.addRouter(input)
+	if err != nil {
+		return err
+	}
+	if err := inv.save(); err != nil {
+		return err
+	}
+	routerLogger(router).Info("routeur ajouté")
+
+	return nil
+}
+
+// Retire un routeur et écrit les fichiers.
+// Prend en entrée la saisie de l'IP (string) et renvoie une erreur.
+func saveRemovedRouter(input string) error {
+
+	inv := loadInventory()
+	router, err := inv.removeRouter(input)
+	if err != nil {
+		return err
+	}
+	if err := inv.save(); err != nil {
+		return err
+	}
+	routerLogger(router).Info("routeur supprimé")
+
+	return nil
+}
+
+// Coordonnées saisies à la main dans les options d'une sous-commande: --lat et --lon, ou --coords "lat, lon".
+type CoordsFlags struct {
+	Lat    float64
+	Lon    float64
+	Coords string
+}
+
+// Ajoute les options de coordonnées à une sous-commande.
+// Prend en entrée le jeu d'options (*getopt.Set) et renvoie les coordonnées (*CoordsFlags), remplies lors de l'analyse des options.
+func addCoordsFlags(set *getopt.Set) *CoordsFlags {
+
+	var flags CoordsFlags
+	set.FlagLong(&flags.Lat, "lat", 0, "Latitude (avec --lon), l'adresse n'est alors pas géocodée.")
+	set.FlagLong(&flags.Lon, "lon", 0, "Longitude (avec --lat).")
+	set.FlagLong(&flags.Coords, "coords", 0, "Latitude et longitude en une seule option (ex: \"45.43, 4.39\").")
+
+	return &flags
+}
+
+// Renvoie les coordonnées saisies.
+// Méthode de *CoordsFlags. Prend en entrée le jeu d'options analysé (*getopt.Set), renvoie latitude et longitude (*float64, nil si non saisies)
+// ou une erreur (errUsage) si --coords est invalide ou utilisée avec --lat/--lon.
+// La présence des deux coordonnées et leurs limites sont vérifiées lors de l'ajout ou de la modification du routeur.
+func (flags *CoordsFlags) parse(set *getopt.Set) (*float64, *float64, error) {
+
+	var lat, lon *float64
+	if set.IsSet("coords") {
+		if set.IsSet("lat") || set.IsSet("lon") {
+			return nil, nil, fmt.Errorf("%w: --coords ne peut pas être utilisée avec --lat ou --lon", errUsage)
+		}
+		var err error
+		flags.Lat, flags.Lon, err = parseCoords(flags.Coords)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &flags.Lat, &flags.Lon, nil
+	}
+	if set.IsSet("lat") {
+		lat = &flags.Lat
+	}
+	if set.IsSet("lon") {
+		lon = &flags.Lon
+	}
+
+	return lat, lon, nil
+}
+
+// Sous-commande add: ajoute un routeur.
+// Prend en entrée les options globales (*Options) et les arguments ([]string), renvoie une erreur.
+func cmdAdd(opts *Options, args []string) error {
+
+	var input RouterInput
+	set := newFlagSet("add", "")
+	set.FlagLong(&input.Target, "ip", 0, "Adresse IP ou nom DNS du routeur.")
+	set.FlagLong(&input.Address, "address", 0, "Adresse postale (le routeur n'est pas affiché sur la carte si elle est vide et sans coordonnées).")
+	set.FlagLong(&input.Users, "user", 0, "Utilisateurs Grafana associés, séparés par des virgules (@nom pour un groupe).")
+	set.FlagLong(&input.Type, "type", 0, "Type d'appareil ("+typeHelp()+"). Défaut: mikrotik, ou watchguard si l'IP est préfixée par W.")
+	set.FlagLong(&input.Parent, "parent", 0, "IP du routeur parent (optionnel).")
+	coords := addCoordsFlags(set)
+	if _, err := parseFlags(set, args, 0); err != nil {
+		return err
+	}
+	var err error
+	input.Lat, input.Lon, err = coords.parse(set)
+	if err != nil {
+		return err
+	}
+
+	// Invite interactive pour les champs non renseignés si l'IP est absente
+	if input.Target == "" {
+		if err := requirePrompt("ip"); err != nil {
+			return err
+		}
+		input, err = promptRouter(input)
+		if err != nil {
+			return err
+		}
+	}
+
+	return saveNewRouter(input)
+}
+
+// Sous-commande remove: retire un routeur.
+// Prend en entrée les options globales (*Options) et les arguments ([]string), renvoie une erreur.
+func cmdRemove(opts *Options, args []string) error {
+
+	var ip string
+	set := newFlagSet("remove", "")
+	set.FlagLong(&ip, "ip", 0, "Adresse IP ou nom DNS du routeur.")
+	if _, err := parseFlags(set, args, 0); err != nil {
+		return err
+	}
+
+	if ip == "" {
+		if err := requirePrompt("ip"); err != nil {
+			return err
+		}
+		var err error
+		ip, err = promptRemove()
+		if err != nil {
+			return err
+		}
+	}
+
+	return saveRemovedRouter(ip)
+}
+
+// Sous-commande show: affiche le détail d'un routeur.
+// Prend en entrée les options globales (*Options) et les arguments ([]string), renvoie une erreur.
+func cmdShow(opts *Options, args []string) error {
+
+	var ip string
+	var asJSON bool
+	set := newFlagSet("show", "[ip]")
+	set.FlagLong(&ip, "ip", 0, "Adresse IP ou nom DNS du routeur (ou en paramètre).")
+	set.FlagLong(&asJSON, "json", 0, "Afficher le routeur au format JSON.")
+	positional, err := parseFlags(set, args, 1)
+	if err != nil {
+		return err
+	}
+	if ip == "" && len(positional) > 0 {
+		ip = positional[0]
+	}
+	if ip == "" {
+		set.PrintUsage(os.Stderr)
+		return fmt.Errorf("%w: l'option --ip est obligatoire", errUsage)
+	}
+
+	inv := loadInventory()
+	i, err := inv.lookup(ip)
+	if err != nil {
+		return err
+	}
+	router := inv.Routers[i]
+
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "    ")
+		return enc.Encode(struct {
+			Router
+			Jobs    []string `json:"jobs"`
+			Modules []string `json:"modules"`
+		}{router, inv.jobs(router.IP), inv.Profiles[router.Type].Modules})
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "IP\t%s\n", router.IP)
+	fmt.Fprintf(w, "Type\t%s\n", router.Type)
+	fmt.Fprintf(w, "Utilisateurs\t%s\n", strings.Join(routerUsers(router), ", "))
+	fmt.Fprintf(w, "Adresse\t%s\n", router.Adresse)
+	fmt.Fprintf(w, "Coordonnées\t%f, %f\n", router.Lat, router.Lon)
+	fmt.Fprintf(w, "Visible\t%t\n", router.Visible)
+	fmt.Fprintf(w, "Parent\t%s\n", router.Parent)
+	fmt.Fprintf(w, "Jobs Prometheus\t%s\n", strings.Join(inv.jobs(router.IP), ", "))
+	fmt.Fprintf(w, "Modules SNMP\t%s\n", strings.Join(inv.Profiles[router.Type].Modules, ", "))
+
+	return w.Flush()
+}
+
+// Sous-commande users: "users sync" crée dans Grafana les utilisateurs ayant accès à au moins un routeur.
+// Prend en entrée les options globales (*Options) et les arguments ([]string), renvoie une erreur.
+func cmdUsers(opts *Options, args []string) error {
+
+	pass, grafanaIP := opts.Pass, opts.GrafanaIP
+	set := newFlagSet("users", "sync")
+	set.FlagLong(&pass, "pass", 'p', "Mot de passe administrateur de Grafana.\nDéfaut:")
+	set.FlagLong(&grafanaIP, "grafana", 'g', "IP:port de l'instance Grafana.\nDéfaut:")
+	positional, err := parseFlags(set, args, 1)
+	if err != nil {
+		return err
+	}
+	if len(positional) == 0 || positional[0] != "sync" {
+		set.PrintUsage(os.Stderr)
+		return fmt.Errorf("%w: action attendue: sync", errUsage)
+	}
+
+	addUsers(loadInventory(), pass, grafanaIP)
+
+	return nil
+}
+
+// Sous-commande compliance: affiche le rapport de conformité des versions RouterOS.
+// Prend en entrée les options globales (*Options) et les arguments ([]string), renvoie une erreur.
+func cmdCompliance(opts *Options, args []string) error {
+
+	set := newFlagSet("compliance", "")
+	set.FlagLong(&opts.APIURL, "api", 0, "URL de mikromap-api.\nDéfaut:")
+	set.FlagLong(&opts.APIToken, "api-token", 0, "Jeton d'accès à mikromap-api.")
+	if _, err := parseFlags(set, args, 0); err != nil {
+		return err
+	}
+
+	return showCompliance(opts.APIURL, opts.APIToken)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseFlags(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		args       []string
+		maxArgs    int
+		positional []string
+		typ        string
+		yes        bool
+		err        error
+	}{
+		{"options seules", []string{"edit", "--type", "fortinet", "-y"}, 1, nil, "fortinet", true, nil},
+		{"options après le paramètre", []string{"edit", "10.0.0.1", "--type", "fortinet"}, 1, []string{"10.0.0.1"}, "fortinet", false, nil},
+		{"options avant le paramètre", []string{"edit", "--type=fortinet", "10.0.0.1", "-y"}, 1, []string{"10.0.0.1"}, "fortinet", true, nil},
+		{"options entre les paramètres", []string{"users", "sync", "-y", "extra"}, 2, []string{"sync", "extra"}, "", true, nil},
+		{"après --", []string{"edit", "-y", "--", "-10.0.0.1"}, 1, []string{"-10.0.0.1"}, "", true, nil},
+		{"trop de paramètres", []string{"edit", "10.0.0.1", "10.0.0.2"}, 1, nil, "", false, errUsage},
+		{"paramètre refusé", []string{"list", "10.0.0.1"}, 0, nil, "", false, errUsage},
+		{"option inconnue", []string{"edit", "10.0.0.1", "--inconnue"}, 1, nil, "", false, errUsage},
+		{"valeur manquante", []string{"edit", "10.0.0.1", "--type"}, 1, nil, "", false, errUsage},
+		{"aide", []string{"edit", "10.0.0.1", "--help"}, 1, nil, "", false, errHelp},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var typ string
+			var yes bool
+			set := newFlagSet(tt.args[0], "[IP]")
+			set.FlagLong(&typ, "type", 0, "Type d'appareil.")
+			set.FlagLong(&yes, "yes", 'y', "Ne pas demander de confirmation.")
+
+			positional, err := parseFlags(set, tt.args, tt.maxArgs)
+			if !errors.Is(err, tt.err) || (err != nil) != (tt.err != nil) {
+				t.Fatalf("erreur = %v, attendu %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(positional, tt.positional) || typ != tt.typ || yes != tt.yes {
+				t.Errorf("paramètres, type, yes = %q, %q, %v, attendu %q, %q, %v", positional, typ, yes, tt.positional, tt.typ, tt.yes)
+			}
+		})
+	}
+}
+
+func TestRequireConfirm(t *testing.T) {
+
+	t.Setenv("HOME", t.TempDir())
+
+	// Entrée standard hors d'un terminal (go test la relie souvent à /dev/null, un périphérique caractère)
+	file, err := os.CreateTemp(t.TempDir(), "stdin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := os.Stdin
+	os.Stdin = file
+	t.Cleanup(func() { os.Stdin = previous; file.Close() })
+
+	if err := os.MkdirAll(filepath.Dir(getPath("routers.json")), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(getPath("routers.json"), []byte(`[{"ip": "10.0.0.1", "type": "mikrotik", "visible": true}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		args []string
+		err  error
+	}{
+		{[]string{"regeocode"}, errUsage},
+		{[]string{"regeocode", "--yes"}, nil},
+		{[]string{"regeocode", "--dry-run"}, nil},
+		{[]string{"edit", "10.0.0.1", "--visible", "false"}, errUsage},
+		{[]string{"edit", "10.0.0.1", "--visible", "false", "--dry-run"}, nil},
+		{[]string{"edit", "10.0.0.1", "--visible", "false", "--yes"}, nil},
+	}
+	commands := map[string]func(*Options, []string) error{"regeocode": cmdRegeocode, "edit": cmdEdit}
+	for _, tt := range tests {
+		if err := commands[tt.args[0]](&Options{}, tt.args); !errors.Is(err, tt.err) || (err != nil) != (tt.err != nil) {
+			t.Errorf("%v: erreur = %v, attendu %v", tt.args, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Structure de la réponse de /api/v1/compliance (voir mikromap-api).
+type ComplianceReport struct {
+	Utilisateurs []struct {
+		Username     string `json:"username"`
+		Total        int    `json:"total"`
+		Conformes    int    `json:"conformes"`
+		NonConformes int    `json:"non_conformes"`
+		Inconnus     int    `json:"inconnus"`
+		Routers      []struct {
+			IP         string `json:"ip"`
+			Identite   string `json:"identite"`
+			Version    string `json:"version"`
+			Conformite *struct {
+				Conforme bool     `json:"conforme"`
+				Raisons  []string `json:"raisons"`
+			} `json:"conformite"`
+		} `json:"routers"`
+	} `json:"utilisateurs"`
+}
+
+// Fait un appel GET à mikromap-api.
+// Prend en entrée l'URL de base de l'API (string), le chemin avec ses paramètres (string) et le jeton (string, optionnel),
+// renvoie le corps de la réponse ([]byte) ou une erreur si l'API est injoignable ou ne renvoie pas un 200.
+func apiGet(apiURL string, path string, token string) ([]byte, error) {
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(apiURL, "/")+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	client := &http.Client{Timeout: time.Second * 10}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return body, nil
+}
+
+// Affiche le rapport de conformité des versions RouterOS, regroupé par utilisateur Grafana.
+// Prend en entrée l'URL de base de mikromap-api (string) et le jeton (string, optionnel),
+// renvoie une erreur si l'API est injoignable ou que sa réponse est illisible.
+func showCompliance(apiURL string, token string) error {
+
+	body, err := apiGet(apiURL, "/api/v1/compliance?user=admin", token)
+	if err != nil {
+		return fmt.Errorf("erreur lors de la récupération du rapport de conformité auprès de %s: %w", apiURL, err)
+	}
+
+	var report ComplianceReport
+	err = json.Unmarshal(body, &report)
+	if err != nil {
+		return fmt.Errorf("réponse de %s illisible: %w", apiURL, err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, u := range report.Utilisateurs {
+		fmt.Fprintf(w, "%s\t(%d routeurs, %d conformes, %d non conformes, %d inconnus)\n", u.Username, u.Total, u.Conformes, u.NonConformes, u.Inconnus)
+		for _, r := range u.Routers {
+			state := "inconnu"
+			var reasons string
+			if r.Conformite != nil {
+				state = "conforme"
+				if !r.Conformite.Conforme {
+					state = "NON CONFORME"
+					reasons = strings.Join(r.Conformite.Raisons, "; ")
+				}
+			}
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%s\n", r.IP, r.Identite, r.Version, state, reasons)
+		}
+		fmt.Fprintln(w)
+	}
+
+	return w.Flush()
+}
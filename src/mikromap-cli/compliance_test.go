@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCmdCompliance(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		ok     bool
+	}{
+		{"rapport", http.StatusOK, `{"utilisateurs": [{"username": "CLIENT1", "total": 1, "conformes": 1, "routers": [{"ip": "10.0.0.1", "version": "7.14", "conformite": {"conforme": true}}]}]}`, true},
+		{"erreur de l'API", http.StatusUnauthorized, "jeton invalide", false},
+		{"réponse illisible", http.StatusOK, "<html>", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			// L'erreur est renvoyée (code de sortie 1) au lieu d'arrêter le programme
+			opts := &Options{APIURL: server.URL}
+			if err := cmdCompliance(opts, []string{"compliance"}); (err == nil) != tt.ok {
+				t.Errorf("cmdCompliance = %v, succès attendu: %v", err, tt.ok)
+			}
+		})
+	}
+
+	// API injoignable
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	if err := cmdCompliance(&Options{APIURL: server.URL}, []string{"compliance"}); err == nil {
+		t.Error("API injoignable: erreur attendue")
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+)
+
+// Structure mikromap.json (configuration partagée par mikromap-api et mikromap-cli).
+// Le fichier est optionnel: s'il n'existe pas, la configuration par défaut est utilisée.
+type Config struct {
+	Groups    map[string][]string      `json:"groups"`  // Nom du groupe -> utilisateurs Grafana membres
+	Devices   map[string]DeviceProfile `json:"devices"` // Type d'appareil -> profil, ajouté aux profils par défaut (voir defaultProfiles)
+	Geocoding GeocodingConfig          `json:"geocoding"`
+}
+
+// Profil d'un type d'appareil: fichiers de cibles Prometheus et modules snmp_exporter qui s'appliquent aux appareils de ce type.
+// Pour ajouter un type, déclarer son profil dans mikromap.json et le job correspondant dans prometheus_config.yml.
+type DeviceProfile struct {
+	Targets  []string `json:"targets"`  // Fichiers de cibles Prometheus (dans conf/) où sont déclarés les appareils
+	Modules  []string `json:"modules"`  // Modules snmp_exporter des jobs correspondants
+	RouterOS bool     `json:"routeros"` // Appareil sous RouterOS (interrogation de l'API RouterOS et sauvegardes par mikromap-api)
+}
+
+// Profils par défaut. Le type d'appareil par défaut est mikrotik.
+func defaultProfiles() map[string]DeviceProfile {
+
+	return map[string]DeviceProfile{
+		"mikrotik":   {Targets: []string{"global_targets.json", "mikrotik_targets.json"}, Modules: []string{"global", "mikrotik"}, RouterOS: true},
+		"watchguard": {Targets: []string{"global_targets.json"}, Modules: []string{"global"}},
+		"fortinet":   {Targets: []string{"global_targets.json", "fortinet_targets.json"}, Modules: []string{"global", "fortigate_snmp"}},
+		"snmp":       {Targets: []string{"global_targets.json"}, Modules: []string{"global"}},
+	}
+}
+
+// Récupère la configuration dans mikromap.json.
+// Ne prend rien en entrée et renvoie la configuration (Config).
+func readConfig() Config {
+
+	var config Config
+	config.Devices = defaultProfiles()
+	config.Geocoding.Candidates = 5
+	config.Geocoding.BAN.MinScore = 0.5
+
+	// Lecture du fichier
+	content, err := os.ReadFile(getPath("mikromap.json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return config
+	}
+	if err != nil {
+		fatal("erreur lors de la lecture du fichier de configuration", "file", getPath("mikromap.json"), "error", err)
+	}
+
+	// Traitement des données
+	err = json.NewDecoder(bytes.NewBuffer(content)).Decode(&config)
+	if err != nil {
+		fatal("erreur lors du traitement des données du fichier de configuration", "file", getPath("mikromap.json"), "error", err)
+	}
+
+	return config
+}
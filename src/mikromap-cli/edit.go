@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Champ d'un routeur modifié par edit.
+type FieldChange struct {
+	Field string
+	Old   string
+	New   string
+}
+
+// Renvoie les champs d'un routeur tels qu'ils sont comparés avant et après modification.
+// Méthode de *Inventory. Prend en entrée le routeur (Router) et renvoie les paires nom/valeur ([][2]string).
+// Le type et les jobs Prometheus sont lus dans les fichiers de cibles: appeler avant et après la modification de l'inventaire.
+func (inv *Inventory) fields(router Router) [][2]string {
+
+	return [][2]string{
+		{"ip", router.IP},
+		{"type", router.Type},
+		{"username", router.Username},
+		{"users", strings.Join(router.Users, ", ")},
+		{"groups", strings.Join(router.Groups, ", ")},
+		{"adresse", router.Adresse},
+		{"lat", strconv.FormatFloat(router.Lat, 'f', -1, 64)},
+		{"lon", strconv.FormatFloat(router.Lon, 'f', -1, 64)},
+		{"visible", strconv.FormatBool(router.Visible)},
+		{"manual", strconv.FormatBool(router.Manual)},
+		{"parent", router.Parent},
+		{"jobs", strings.Join(inv.jobs(router.IP), ", ")},
+	}
+}
+
+// Compare les champs d'un routeur avant et après modification.
+// Prend en entrée les champs avant et après ([][2]string, voir fields) et renvoie les champs modifiés ([]FieldChange).
+func diffFields(before [][2]string, after [][2]string) []FieldChange {
+
+	var res []FieldChange
+	for i := range before {
+		if before[i][1] != after[i][1] {
+			res = append(res, FieldChange{before[i][0], before[i][1], after[i][1]})
+		}
+	}
+
+	return res
+}
+
+// Affiche les modifications d'un routeur, en couleur dans un terminal.
+// Prend en entrée l'IP du routeur (string) et les champs modifiés ([]FieldChange), ne renvoie rien.
+func printChanges(ip string, changes []FieldChange) {
+
+	writeChanges(os.Stdout, ip, changes, interactive())
+}
+
+// Ecrit les modifications d'un routeur.
+// Prend en entrée la destination (io.Writer), l'IP du routeur (string), les champs modifiés ([]FieldChange)
+// et si les anciennes et nouvelles valeurs sont colorées (bool, codes ANSI), ne renvoie rien.
+func writeChanges(out io.Writer, ip string, changes []FieldChange, color bool) {
+
+	red, green, reset := "", "", ""
+	if color {
+		red, green, reset = "\033[31m", "\033[32m", "\033[0m"
+	}
+
+	fmt.Fprintf(out, "--- Modifications de %s\n", ip)
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for _, v := range changes {
+		fmt.Fprintf(w, "%s\t%s%q%s\t->\t%s%q%s\n", v.Field, red, v.Old, reset, green, v.New, reset)
+	}
+	w.Flush()
+}
+
+// Demande confirmation avant d'écrire les fichiers.
+// Ne prend rien en entrée et renvoie true si l'utilisateur a répondu oui.
+func confirm() bool {
+
+	answer, err := prompt("\033[33mAppliquer les modifications ? [o/N] >> \033[0m")
+	if err != nil {
+		return false
+	}
+
+	return slices.Contains([]string{"o", "oui", "y", "yes"}, strings.ToLower(answer))
+}
+
+// Sous-commande edit: modifie un routeur. Seules les options renseignées sont modifiées.
+// Les modifications sont affichées avant l'écriture, et doivent être confirmées (sauf avec --yes, obligatoire hors d'un terminal).
+// Prend en entrée les options globales (*Options) et les arguments ([]string), renvoie une erreur.
+func cmdEdit(opts *Options, args []string) error {
+
+	var ip, newIP, address, visible, users, deviceType, parent string
+	var yes, dryRun bool
+	set := newFlagSet("edit", "[ip]")
+	set.FlagLong(&ip, "ip", 0, "Adresse IP ou nom DNS du routeur à modifier (ou en paramètre).")
+	set.FlagLong(&newIP, "new-ip", 0, "Nouvelle adresse IP ou nouveau nom DNS.")
+	set.FlagLong(&address, "address", 0, "Nouvelle adresse postale, géocodée sauf si des coordonnées sont renseignées (vide pour masquer le routeur sur la carte).")
+	set.FlagLong(&visible, "visible", 0, "Afficher (true) ou masquer (false) le routeur sur la carte.")
+	set.FlagLong(&users, "user", 0, "Nouveaux utilisateurs Grafana, séparés par des virgules (@nom pour un groupe).")
+	set.FlagLong(&deviceType, "type", 0, "Nouveau type d'appareil ("+typeHelp()+").")
+	set.FlagLong(&parent, "parent", 0, "Nouveau routeur parent (vide pour le retirer).")
+	set.FlagLong(&yes, "yes", 'y', "Ne pas demander de confirmation.")
+	set.FlagLong(&dryRun, "dry-run", 0, "Afficher les modifications sans écrire les fichiers.")
+	coords := addCoordsFlags(set)
+	positional, err := parseFlags(set, args, 1)
+	if err != nil {
+		return err
+	}
+	if ip == "" && len(positional) > 0 {
+		ip = positional[0]
+	}
+	if ip == "" {
+		set.PrintUsage(os.Stderr)
+		return fmt.Errorf("%w: l'option --ip est obligatoire", errUsage)
+	}
+	if err := requireConfirm(yes || dryRun); err != nil {
+		return err
+	}
+
+	var edit RouterEdit
+	if set.IsSet("new-ip") {
+		edit.IP = &newIP
+	}
+	if set.IsSet("address") {
+		edit.Address = &address
+	}
+	edit.Lat, edit.Lon, err = coords.parse(set)
+	if err != nil {
+		return err
+	}
+	if set.IsSet("visible") {
+		v, err := strconv.ParseBool(visible)
+		if err != nil {
+			return fmt.Errorf("%w: --visible attend true ou false", errUsage)
+		}
+		edit.Visible = &v
+	}
+	if set.IsSet("user") {
+		edit.Users = &users
+	}
+	if set.IsSet("type") {
+		edit.Type = &deviceType
+	}
+	if set.IsSet("parent") {
+		edit.Parent = &parent
+	}
+
+	inv := loadInventory()
+	i, err := inv.lookup(ip)
+	if err != nil {
+		return err
+	}
+	before := inv.fields(inv.Routers[i])
+	children := 0
+	for _, v := range inv.Routers {
+		if v.Parent == inv.Routers[i].IP {
+			children++
+		}
+	}
+
+	router, err := inv.editRouter(ip, edit)
+	if err != nil {
+		return err
+	}
+
+	// Affichage des modifications
+	changes := diffFields(before, inv.fields(router))
+	if len(changes) == 0 {
+		fmt.Println("Aucune modification.")
+		return nil
+	}
+	printChanges(before[0][1], changes)
+	if router.IP != before[0][1] && children > 0 {
+		fmt.Printf("%d routeur(s) enfant(s) rattaché(s) à %s\n", children, router.IP)
+	}
+
+	if dryRun {
+		fmt.Println("--dry-run: aucun fichier modifié.")
+		return nil
+	}
+	if !yes && !confirm() {
+		fmt.Println("Modifications annulées.")
+		return nil
+	}
+
+	if err := inv.save(); err != nil {
+		return err
+	}
+	routerLogger(router).Info("routeur modifié")
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestDiffFields(t *testing.T) {
+
+	str := func(s string) *string { return &s }
+	num := func(f float64) *float64 { return &f }
+	no := false
+
+	tests := []struct {
+		name string
+		edit RouterEdit
+		want []FieldChange
+	}{
+		{"aucune modification", RouterEdit{}, nil},
+		{"même valeur", RouterEdit{Users: str("client1"), Parent: str("10.0.0.254")}, nil},
+		{"visibilité", RouterEdit{Visible: &no}, []FieldChange{{"visible", "true", "false"}}},
+		{"utilisateurs", RouterEdit{Users: str("client2, client3")}, []FieldChange{
+			{"username", "CLIENT1", "CLIENT2"},
+			{"users", "", "CLIENT3"},
+		}},
+		{"coordonnées", RouterEdit{Lat: num(45.5), Lon: num(4.4)}, []FieldChange{
+			{"lat", "45.43", "45.5"},
+			{"lon", "4.39", "4.4"},
+			{"manual", "false", "true"},
+		}},
+		{"type et jobs", RouterEdit{Type: str("watchguard")}, []FieldChange{
+			{"type", "mikrotik", "watchguard"},
+			{"jobs", "global, mikrotik", "global"},
+		}},
+		{"ip et parent", RouterEdit{IP: str("10.0.0.2"), Parent: str("")}, []FieldChange{
+			{"ip", "10.0.0.1", "10.0.0.2"},
+			{"parent", "10.0.0.254", ""},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inv := &Inventory{Targets: make(map[string][]PromTargets), Profiles: defaultProfiles(), Cache: make(GeoCache)}
+			inv.insert(Router{IP: "10.0.0.254", Type: typeMikrotik})
+			inv.insert(Router{IP: "10.0.0.1", Type: typeMikrotik, Username: "CLIENT1", Adresse: "1 Rue Leclerc", Lat: 45.43, Lon: 4.39, Visible: true, Parent: "10.0.0.254"})
+
+			before := inv.fields(inv.Routers[1])
+			router, err := inv.editRouter("10.0.0.1", tt.edit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := diffFields(before, inv.fields(router)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diffFields = %v, attendu %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteChanges(t *testing.T) {
+
+	changes := []FieldChange{{"visible", "true", "false"}, {"parent", "10.0.0.254", ""}}
+
+	tests := []struct {
+		name  string
+		color bool
+		want  string
+	}{
+		{"hors d'un terminal", false, "--- Modifications de 10.0.0.1\nvisible  \"true\"        ->  \"false\"\nparent   \"10.0.0.254\"  ->  \"\"\n"},
+		{"terminal", true, "--- Modifications de 10.0.0.1\nvisible  \x1b[31m\"true\"\x1b[0m        ->  \x1b[32m\"false\"\x1b[0m\nparent   \x1b[31m\"10.0.0.254\"\x1b[0m  ->  \x1b[32m\"\"\x1b[0m\n"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		writeChanges(&buf, "10.0.0.1", changes, tt.color)
+		if buf.String() != tt.want {
+			t.Errorf("%s: writeChanges = %q, attendu %q", tt.name, buf.String(), tt.want)
+		}
+	}
+}
@@ -0,0 +1,469 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pborman/getopt/v2"
+	"github.com/xuri/excelize/v2"
+)
+
+// Routeur tel qu'il est exporté ou listé: champs de routers.json, type, jobs Prometheus et statut en direct (optionnel).
+// Les noms de colonnes reprennent ceux de l'import pour qu'un export CSV puisse être réimporté.
+type RouterRecord struct {
+	IP       string   `json:"ip"`
+	Type     string   `json:"type"`
+	User     string   `json:"user"` // Utilisateurs et groupes (@nom) séparés par des virgules, comme à la saisie
+	Username string   `json:"username"`
+	Address  string   `json:"address"`
+	Lat      *float64 `json:"lat"` // nil si le routeur n'est pas affiché sur la carte
+	Lon      *float64 `json:"lon"`
+	Visible  bool     `json:"visible"`
+	Parent   string   `json:"parent"`
+	Jobs     []string `json:"jobs"`
+
+	// Renseignés par mikromap-api (--status)
+	Statut  string   `json:"statut,omitempty"` // up, down, injoignable
+	RTT     *float64 `json:"rtt,omitempty"`
+	Cause   string   `json:"cause,omitempty"`
+	Version string   `json:"version,omitempty"` // Version RouterOS
+}
+
+// Filtres sur les routeurs (champs vides: pas de filtre).
+type RouterFilter struct {
+	User    string // Utilisateur Grafana ayant accès au routeur (utilisateur principal, supplémentaire ou membre d'un groupe)
+	Address string // Partie de l'adresse postale, sans tenir compte de la casse
+	Visible string // true ou false
+	Type    string
+	Statut  string // Statut en direct (up, down, injoignable), nécessite le statut renvoyé par mikromap-api
+}
+
+// Libellés des statuts renvoyés par mikromap-api.
+var statutLabels = map[int]string{0: "down", 1: "up", 2: "injoignable"}
+
+// Ajoute les options de filtre à une sous-commande.
+// Prend en entrée le jeu d'options (*getopt.Set) et renvoie les filtres (*RouterFilter), remplis lors de l'analyse des options.
+func addFilterFlags(set *getopt.Set) *RouterFilter {
+
+	var filter RouterFilter
+	set.FlagLong(&filter.User, "user", 0, "Routeurs accessibles par cet utilisateur Grafana.")
+	set.FlagLong(&filter.Address, "address", 0, "Routeurs dont l'adresse postale contient ce texte.")
+	set.FlagLong(&filter.Visible, "visible", 0, "Routeurs affichés (true) ou non (false) sur la carte.")
+	set.FlagLong(&filter.Type, "type", 0, "Type d'appareil ("+typeHelp()+").")
+
+	return &filter
+}
+
+// Vérifie les filtres saisis.
+// Méthode de *RouterFilter. Prend en entrée les profils d'appareils (map type -> DeviceProfile) et renvoie une erreur (errUsage) si un filtre est invalide.
+func (filter *RouterFilter) check(profiles map[string]DeviceProfile) error {
+
+	if filter.Visible != "" {
+		visible, err := strconv.ParseBool(filter.Visible)
+		if err != nil {
+			return fmt.Errorf("%w: --visible attend true ou false", errUsage)
+		}
+		filter.Visible = strconv.FormatBool(visible)
+	}
+	if filter.Type != "" {
+		deviceType, err := checkType(filter.Type, profiles)
+		if err != nil {
+			return err
+		}
+		filter.Type = deviceType
+	}
+	if filter.Statut != "" {
+		filter.Statut = strings.ToLower(filter.Statut)
+		if !slices.Contains([]string{"up", "down", "injoignable"}, filter.Statut) {
+			return fmt.Errorf("%w: statut inconnu '%s' (attendu: up, down, injoignable)", errUsage, filter.Statut)
+		}
+	}
+
+	return nil
+}
+
+// Indique si un routeur correspond aux filtres.
+// Méthode de RouterFilter. Prend en entrée le routeur (Router) et les groupes de la configuration (map nom -> membres), renvoie un booléen.
+func (filter RouterFilter) match(router Router, groups map[string][]string) bool {
+
+	if filter.Visible != "" && strconv.FormatBool(router.Visible) != filter.Visible {
+		return false
+	}
+	if filter.Type != "" && router.Type != filter.Type {
+		return false
+	}
+	if filter.Address != "" && !strings.Contains(strings.ToLower(router.Adresse), strings.ToLower(filter.Address)) {
+		return false
+	}
+	if filter.User != "" {
+		allowed := append([]string{router.Username}, router.Users...)
+		for _, g := range router.Groups {
+			allowed = append(allowed, groups[g]...)
+		}
+		if !slices.ContainsFunc(allowed, func(v string) bool { return strings.EqualFold(v, filter.User) }) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Récupère le statut en direct des routeurs auprès de mikromap-api.
+// Prend en entrée les options globales (*Options) et renvoie les routeurs par IP (map IP -> Router) ou une erreur.
+func fetchStatus(opts *Options) (map[string]Router, error) {
+
+	body, err := apiGet(opts.APIURL, "/api/v1/mikromap?user=admin", opts.APIToken)
+	if err != nil {
+		return nil, fmt.Errorf("erreur lors de la récupération du statut des routeurs auprès de %s: %w", opts.APIURL, err)
+	}
+
+	var data []Router
+	err = json.Unmarshal(body, &data)
+	if err != nil {
+		return nil, fmt.Errorf("réponse de l'API illisible: %w", err)
+	}
+
+	res := make(map[string]Router)
+	for _, v := range data {
+		res[v.IP] = v
+	}
+
+	return res, nil
+}
+
+// Construit les lignes d'inventaire des routeurs correspondant aux filtres.
+// Méthode de *Inventory. Prend en entrée les filtres (RouterFilter) et le statut en direct (map IP -> Router, nil si non demandé),
+// renvoie les lignes ([]RouterRecord) dans l'ordre de routers.json.
+func (inv *Inventory) records(filter RouterFilter, status map[string]Router) []RouterRecord {
+
+	var res []RouterRecord
+	for _, v := range inv.Routers {
+		if !filter.match(v, inv.Groups) {
+			continue
+		}
+
+		rec := RouterRecord{
+			IP:       v.IP,
+			Type:     v.Type,
+			User:     strings.Join(routerUsers(v), ", "),
+			Username: v.Username,
+			Address:  v.Adresse,
+			Visible:  v.Visible,
+			Parent:   v.Parent,
+			Jobs:     inv.jobs(v.IP),
+		}
+		if v.Visible {
+			rec.Lat, rec.Lon = &v.Lat, &v.Lon
+		}
+
+		if status != nil {
+			live, ok := status[v.IP]
+			rec.Statut = "inconnu"
+			if ok {
+				rtt := live.RTT
+				rec.Statut, rec.RTT, rec.Cause = statutLabels[live.Statut], &rtt, live.Cause
+				var info struct {
+					Version string `json:"version"`
+				}
+				if json.Unmarshal(live.RouterOS, &info) == nil {
+					rec.Version = info.Version
+				}
+			}
+		}
+		if filter.Statut != "" && rec.Statut != filter.Statut {
+			continue
+		}
+
+		res = append(res, rec)
+	}
+
+	return res
+}
+
+// Renvoie les colonnes d'une ligne d'inventaire sous forme de texte.
+// Méthode de RouterRecord. Prend en entrée les noms des colonnes ([]string) et renvoie les valeurs ([]string).
+func (rec RouterRecord) values(columns []string) []string {
+
+	float := func(v *float64) string {
+		if v == nil {
+			return ""
+		}
+		return strconv.FormatFloat(*v, 'f', -1, 64)
+	}
+
+	res := make([]string, len(columns))
+	for i, c := range columns {
+		switch c {
+		case "ip":
+			res[i] = rec.IP
+		case "type":
+			res[i] = rec.Type
+		case "user":
+			res[i] = rec.User
+		case "username":
+			res[i] = rec.Username
+		case "address":
+			res[i] = rec.Address
+		case "lat":
+			res[i] = float(rec.Lat)
+		case "lon":
+			res[i] = float(rec.Lon)
+		case "coords":
+			if rec.Lat != nil {
+				res[i] = fmt.Sprintf("%.6f, %.6f", *rec.Lat, *rec.Lon)
+			}
+		case "visible":
+			res[i] = strconv.FormatBool(rec.Visible)
+		case "parent":
+			res[i] = rec.Parent
+		case "jobs":
+			res[i] = strings.Join(rec.Jobs, ", ")
+		case "statut":
+			res[i] = rec.Statut
+		case "rtt":
+			res[i] = float(rec.RTT)
+		case "cause":
+			res[i] = rec.Cause
+		case "version":
+			res[i] = rec.Version
+		}
+	}
+
+	return res
+}
+
+// Colonnes des exports CSV et XLSX.
+var exportColumns = []string{"ip", "type", "user", "address", "lat", "lon", "visible", "parent", "jobs"}
+
+// Colonnes ajoutées quand le statut en direct est demandé.
+var statusColumns = []string{"statut", "rtt", "cause", "version"}
+
+// Ecrit les lignes d'inventaire au format CSV.
+// Prend en entrée la destination (io.Writer), les lignes ([]RouterRecord) et les colonnes ([]string), renvoie une erreur.
+func writeCSV(w io.Writer, records []RouterRecord, columns []string) error {
+
+	writer := csv.NewWriter(w)
+	writer.Write(columns)
+	for _, v := range records {
+		writer.Write(v.values(columns))
+	}
+	writer.Flush()
+
+	return writer.Error()
+}
+
+// Renvoie un nom de feuille XLSX valide (31 caractères maximum, sans []:*?/\).
+// Prend en entrée le nom souhaité (string) et renvoie le nom de feuille (string).
+func sheetName(name string) string {
+
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	if name == "" {
+		name = "Sans utilisateur"
+	}
+	if runes := []rune(name); len(runes) > 31 {
+		name = string(runes[:31])
+	}
+
+	return name
+}
+
+// Rend un nom de feuille unique dans le classeur, en ajoutant un suffixe ~2, ~3... si deux utilisateurs donnent le même nom
+// (caractères remplacés, troncature à 31 caractères, ou casse: Excel ne la distingue pas).
+// Prend en entrée le nom (string, valide, voir sheetName) et les noms déjà utilisés (map en majuscules, complétée avec le nom retenu),
+// renvoie le nom retenu (string).
+func uniqueSheetName(name string, used map[string]bool) string {
+
+	res := name
+	for i := 2; used[strings.ToUpper(res)]; i++ {
+		suffix := fmt.Sprintf("~%d", i)
+		runes := []rune(name)
+		if len(runes)+len(suffix) > 31 {
+			runes = runes[:31-len(suffix)]
+		}
+		res = string(runes) + suffix
+	}
+	used[strings.ToUpper(res)] = true
+
+	return res
+}
+
+// Ecrit les lignes d'inventaire dans un classeur XLSX, avec une feuille par utilisateur Grafana.
+// Prend en entrée la destination (io.Writer), les lignes ([]RouterRecord), les routeurs correspondants (map IP -> Router),
+// les groupes de la configuration (map nom -> membres) et les colonnes ([]string), renvoie une erreur.
+// Un routeur apparaît sur la feuille de chaque utilisateur qui y a accès (y compris via un groupe), les routeurs sans utilisateur sur une feuille dédiée.
+func writeXLSX(w io.Writer, records []RouterRecord, routers map[string]Router, groups map[string][]string, columns []string) error {
+
+	file := excelize.NewFile()
+	defer file.Close()
+
+	// Répartition des routeurs par utilisateur, dans l'ordre de première apparition
+	var sheets []string
+	sheetOf := make(map[string]string) // Utilisateur -> nom de sa feuille
+	used := make(map[string]bool)      // Noms des feuilles déjà créées (voir uniqueSheetName)
+	bySheet := make(map[string][]RouterRecord)
+	for _, rec := range records {
+		users := collectUsers([]Router{routers[rec.IP]}, groups)
+		if len(users) == 0 {
+			users = []string{""}
+		}
+		for _, u := range users {
+			u = strings.ToUpper(u)
+			name, ok := sheetOf[u]
+			if !ok {
+				name = uniqueSheetName(sheetName(u), used)
+				sheetOf[u] = name
+				sheets = append(sheets, name)
+			}
+			bySheet[name] = append(bySheet[name], rec)
+		}
+	}
+	if len(sheets) == 0 {
+		sheets = []string{"Routeurs"}
+	}
+
+	bold, err := file.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	if err != nil {
+		return err
+	}
+
+	for i, name := range sheets {
+		if i == 0 {
+			err = file.SetSheetName("Sheet1", name)
+		} else {
+			_, err = file.NewSheet(name)
+		}
+		if err != nil {
+			return fmt.Errorf("erreur lors de la création de la feuille %s: %w", name, err)
+		}
+
+		stream, err := file.NewStreamWriter(name)
+		if err != nil {
+			return err
+		}
+		header := make([]interface{}, len(columns))
+		for j, c := range columns {
+			header[j] = excelize.Cell{StyleID: bold, Value: c}
+		}
+		if err := stream.SetRow("A1", header); err != nil {
+			return err
+		}
+		for j, rec := range bySheet[name] {
+			row := make([]interface{}, len(columns))
+			for k, v := range rec.values(columns) {
+				row[k] = v
+				if f, err := strconv.ParseFloat(v, 64); err == nil && (columns[k] == "lat" || columns[k] == "lon" || columns[k] == "rtt") {
+					row[k] = f
+				}
+			}
+			cell, _ := excelize.CoordinatesToCellName(1, j+2)
+			if err := stream.SetRow(cell, row); err != nil {
+				return err
+			}
+		}
+		if err := stream.Flush(); err != nil {
+			return err
+		}
+	}
+
+	return file.Write(w)
+}
+
+// Sous-commande export: exporte l'inventaire en CSV, JSON ou XLSX.
+// Prend en entrée les options globales (*Options) et les arguments ([]string), renvoie une erreur.
+func cmdExport(opts *Options, args []string) error {
+
+	var format, output string
+	var status bool
+	set := newFlagSet("export", "")
+	set.FlagLong(&format, "format", 0, "Format de l'export (csv, json, xlsx). Défaut: déduit de l'extension de --output, csv sinon.")
+	set.FlagLong(&output, "output", 'o', "Fichier de destination. Défaut: sortie standard.")
+	set.FlagLong(&status, "status", 0, "Ajouter le statut en direct des routeurs (récupéré auprès de mikromap-api, voir --api).")
+	set.FlagLong(&opts.APIURL, "api", 0, "URL de mikromap-api.\nDéfaut:")
+	set.FlagLong(&opts.APIToken, "api-token", 0, "Jeton d'accès à mikromap-api.")
+	filter := addFilterFlags(set)
+	if _, err := parseFlags(set, args, 0); err != nil {
+		return err
+	}
+	inv := loadInventory()
+	if err := filter.check(inv.Profiles); err != nil {
+		return err
+	}
+
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(output)), ".")
+	}
+	if format == "" {
+		format = "csv"
+	}
+	if !slices.Contains([]string{"csv", "json", "xlsx"}, format) {
+		return fmt.Errorf("%w: format d'export inconnu '%s' (attendu: csv, json, xlsx)", errUsage, format)
+	}
+
+	columns := exportColumns
+	var live map[string]Router
+	if status {
+		var err error
+		live, err = fetchStatus(opts)
+		if err != nil {
+			return err
+		}
+		columns = append(slices.Clip(columns), statusColumns...)
+	}
+	records := inv.records(*filter, live)
+
+	// Destination
+	var w io.Writer = os.Stdout
+	var file *os.File
+	if output != "" && output != "-" {
+		var err error
+		file, err = os.Create(output)
+		if err != nil {
+			return fmt.Errorf("erreur lors de la création du fichier d'export: %w", err)
+		}
+		w = file
+	}
+
+	var err error
+	switch format {
+	case "csv":
+		err = writeCSV(w, records, columns)
+	case "json":
+		if records == nil {
+			records = []RouterRecord{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "    ")
+		err = enc.Encode(records)
+	case "xlsx":
+		routers := make(map[string]Router)
+		for _, v := range inv.Routers {
+			routers[v.IP] = v
+		}
+		err = writeXLSX(w, records, routers, inv.Groups, columns)
+	}
+	// Une erreur à la fermeture peut signifier que le fichier est incomplet (disque plein...)
+	if file != nil {
+		if cerr := file.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("erreur lors de l'écriture de l'export: %w", err)
+	}
+
+	logger.Info("inventaire exporté", "format", format, "routers", len(records))
+
+	return nil
+}
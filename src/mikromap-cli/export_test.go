@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestUniqueSheetName(t *testing.T) {
+
+	long := strings.Repeat("A", 31)
+
+	tests := []struct {
+		name string
+		used []string
+		want string
+	}{
+		{"A", nil, "A"},
+		{"A", []string{"A"}, "A~2"},
+		{"A", []string{"A", "A~2"}, "A~3"},
+		{"SANS UTILISATEUR", []string{"Sans utilisateur"}, "SANS UTILISATEUR~2"},
+		{long, []string{long}, strings.Repeat("A", 29) + "~2"},
+	}
+	for _, tt := range tests {
+		used := make(map[string]bool)
+		for _, v := range tt.used {
+			used[strings.ToUpper(v)] = true
+		}
+		if got := uniqueSheetName(tt.name, used); got != tt.want {
+			t.Errorf("uniqueSheetName(%q, %v) = %q, attendu %q", tt.name, tt.used, got, tt.want)
+		}
+		if !used[strings.ToUpper(tt.want)] {
+			t.Errorf("uniqueSheetName(%q, %v): %q absent des noms utilisés", tt.name, tt.used, tt.want)
+		}
+	}
+}
+
+func TestWriteXLSXSheetCollisions(t *testing.T) {
+
+	// Même nom de feuille après remplacement des caractères interdits, troncature ou changement de casse
+	long := strings.Repeat("B", 35)
+	routers := map[string]Router{
+		"10.0.0.1": {IP: "10.0.0.1", Username: "A/B"},
+		"10.0.0.2": {IP: "10.0.0.2", Username: "A_B"},
+		"10.0.0.3": {IP: "10.0.0.3", Username: long + "1"},
+		"10.0.0.4": {IP: "10.0.0.4", Username: long + "2"},
+		"10.0.0.5": {IP: "10.0.0.5"},
+		"10.0.0.6": {IP: "10.0.0.6", Username: "SANS UTILISATEUR"},
+	}
+	var records []RouterRecord
+	for _, ip := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5", "10.0.0.6"} {
+		records = append(records, RouterRecord{IP: ip})
+	}
+
+	var buf bytes.Buffer
+	if err := writeXLSX(&buf, records, routers, nil, []string{"ip"}); err != nil {
+		t.Fatal(err)
+	}
+	file, err := excelize.OpenReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	want := []string{"A_B", "A_B~2", strings.Repeat("B", 31), strings.Repeat("B", 29) + "~2", "Sans utilisateur", "SANS UTILISATEUR~2"}
+	if got := file.GetSheetList(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("feuilles = %v, attendu %v", got, want)
+	}
+	for i, name := range want {
+		rows, err := file.GetRows(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rows) != 2 || rows[1][0] != records[i].IP {
+			t.Errorf("feuille %s = %v, attendu le routeur %s seul", name, rows, records[i].IP)
+		}
+	}
+}
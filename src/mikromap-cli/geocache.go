@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Mode hors ligne (option --offline): aucun service de géocodage en ligne n'est appelé,
+// seuls le cache, la table statique et les coordonnées saisies à la main sont utilisés.
+var offline bool
+
+// Erreur renvoyée en mode hors ligne quand une adresse doit être géocodée par un service en ligne.
+var errOffline = errors.New("mode hors ligne")
+
+// Adresse géocodée enregistrée dans le cache (geocoding_cache.json).
+type GeoCacheEntry struct {
+	Lat    float64   `json:"lat"`
+	Lon    float64   `json:"lon"`
+	Label  string    `json:"label"`  // Adresse normalisée renvoyée par le service
+	Source string    `json:"source"` // Service qui a géocodé l'adresse
+	Date   time.Time `json:"date"`
+}
+
+// Cache de géocodage: adresse normalisée (voir normalizeAddress) -> résultat retenu.
+// Partagé par add, edit et import, et écrit avec le reste de l'inventaire (voir Inventory.save).
+type GeoCache map[string]GeoCacheEntry
+
+// Lit le cache de géocodage.
+// Ne prend rien en entrée et renvoie le cache (GeoCache), vide si le fichier n'existe pas ou est illisible.
+func readGeoCache() GeoCache {
+
+	cache := make(GeoCache)
+
+	content, err := os.ReadFile(getPath("geocoding_cache.json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return cache
+	}
+	if err == nil {
+		err = json.NewDecoder(bytes.NewBuffer(content)).Decode(&cache)
+	}
+	if err != nil {
+		logger.Warn("cache de géocodage illisible, ignoré", "file", getPath("geocoding_cache.json"), "error", err)
+		return make(GeoCache)
+	}
+
+	return cache
+}
+
+// Cherche une adresse dans le cache.
+// Méthode de GeoCache. Prend en entrée l'adresse (string) et renvoie le résultat (GeoResult) et s'il a été trouvé (bool).
+func (cache GeoCache) get(addr string) (GeoResult, bool) {
+
+	entry, ok := cache[normalizeAddress(addr)]
+	if !ok {
+		return GeoResult{}, false
+	}
+
+	return GeoResult{Lat: entry.Lat, Lon: entry.Lon, Label: entry.Label, Score: -1, Source: "cache", Reliable: true}, true
+}
+
+// Enregistre le résultat retenu pour une adresse, sous l'adresse saisie et sous l'adresse normalisée renvoyée par le service.
+// Méthode de GeoCache. Prend en entrée l'adresse (string) et le résultat (GeoResult), ne renvoie rien.
+// Les résultats de la table statique et du cache lui-même ne sont pas enregistrés.
+func (cache GeoCache) put(addr string, res GeoResult) {
+
+	if res.Source == "static" || res.Source == "cache" {
+		return
+	}
+
+	entry := GeoCacheEntry{Lat: res.Lat, Lon: res.Lon, Label: res.Label, Source: res.Source, Date: time.Now().UTC().Truncate(time.Second)}
+	cache[normalizeAddress(addr)] = entry
+	if res.Label != "" {
+		cache[normalizeAddress(res.Label)] = entry
+	}
+}
+
+// Crée le service de géocodage configuré. En mode hors ligne, seule la table statique est utilisée.
+// Prend en entrée la configuration du géocodage (GeocodingConfig), renvoie le service (Geocoder), le nombre de résultats à demander (int)
+// ou une erreur (errOffline en mode hors ligne si la table statique n'est pas configurée).
+func loadGeocoder(conf GeocodingConfig) (Geocoder, int, error) {
+
+	if offline {
+		if !slices.ContainsFunc(conf.Providers, func(v string) bool { return strings.EqualFold(strings.TrimSpace(v), "static") }) {
+			return nil, 0, errOffline
+		}
+		conf.Providers = []string{"static"}
+	}
+
+	geocoder, err := newGeocoder(conf)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return geocoder, max(conf.Candidates, 1), nil
+}
+
+// Géocode une adresse, depuis le cache si elle y est, avec les services configurés sinon.
+// Méthode de *Inventory. Prend en entrée l'adresse (string) et si l'utilisateur peut choisir parmi les résultats (bool, voir geocodeAddress),
+// renvoie le résultat retenu (GeoResult), ajouté au cache, ou une erreur.
+// Avec choix, le cache n'est pas consulté (sauf hors ligne): les résultats des services sont toujours proposés,
+// pour qu'un mauvais résultat en cache puisse être corrigé par add ou edit.
+func (inv *Inventory) geocode(addr string, choose bool) (GeoResult, error) {
+
+	if res, ok := inv.Cache.get(addr); ok && (!choose || offline) {
+		logger.Debug("adresse trouvée dans le cache de géocodage", "address", addr, "label", res.Label)
+		return res, nil
+	}
+
+	var res GeoResult
+	geocoder, limit, err := loadGeocoder(inv.Geocoding)
+	if err == nil {
+		res, err = geocodeAddress(geocoder, addr, limit, choose)
+	}
+	if offline && (errors.Is(err, errOffline) || errors.Is(err, errAddressNotFound)) {
+		return GeoResult{}, fmt.Errorf("%w: adresse '%s' absente du cache de géocodage, saisir ses coordonnées", errOffline, addr)
+	}
+	if err != nil {
+		return GeoResult{}, err
+	}
+	if choose {
+		// L'ancienne entrée est oubliée même si le résultat choisi n'est pas mis en cache (table statique)
+		delete(inv.Cache, normalizeAddress(addr))
+	}
+	inv.Cache.put(addr, res)
+
+	return res, nil
+}
+
+// Renvoie la distance approximative entre deux points (suffisante pour quelques kilomètres).
+// Prend en entrée latitude et longitude des deux points (float64) et renvoie la distance en mètres (float64).
+func distance(lat1 float64, lon1 float64, lat2 float64, lon2 float64) float64 {
+
+	dx := (lon2 - lon1) * math.Cos((lat1+lat2)/2*math.Pi/180) * 111320
+	dy := (lat2 - lat1) * 110540
+
+	return math.Hypot(dx, dy)
+}
+
+// Routeur déplacé par regeocode.
+type Relocation struct {
+	Router   Router // Routeur avant correction
+	Result   GeoResult
+	Distance float64 // Ecart entre les anciennes et les nouvelles coordonnées, en mètres
+}
+
+// Sous-commande regeocode: géocode à nouveau les adresses de l'inventaire, sans passer par le cache, pour appliquer les corrections
+// des bases d'adresses. Les routeurs dont les coordonnées ont été saisies à la main ne sont pas modifiés.
+// Prend en entrée les options globales (*Options) et les arguments ([]string), renvoie une erreur.
+func cmdRegeocode(opts *Options, args []string) error {
+
+	var rate float64
+	var yes, dryRun bool
+	set := newFlagSet("regeocode", "")
+	set.FlagLong(&rate, "rate", 0, "Nombre maximum d'appels par seconde à chaque service de géocodage. Défaut: limite du service (rate dans mikromap.json).")
+	set.FlagLong(&yes, "yes", 'y', "Ne pas demander de confirmation.")
+	set.FlagLong(&dryRun, "dry-run", 0, "Afficher les corrections sans écrire les fichiers.")
+	filter := addFilterFlags(set)
+	if _, err := parseFlags(set, args, 0); err != nil {
+		return err
+	}
+	if err := requireConfirm(yes || dryRun); err != nil {
+		return err
+	}
+	inv := loadInventory()
+	if err := filter.check(inv.Profiles); err != nil {
+		return err
+	}
+	if rate < 0 {
+		set.PrintUsage(os.Stderr)
+		return fmt.Errorf("%w: --rate doit être positif", errUsage)
+	}
+	maxGeoRate = rate
+	if offline {
+		return fmt.Errorf("%w: regeocode nécessite les services de géocodage en ligne (%v)", errUsage, errOffline)
+	}
+
+	geocoder, limit, err := loadGeocoder(inv.Geocoding)
+	if err != nil {
+		return err
+	}
+
+	// Géocodage des adresses
+	var relocations []Relocation
+	total, failures := 0, 0
+	for i, v := range inv.Routers {
+		if v.Adresse == "" || v.Manual || !filter.match(v, inv.Groups) {
+			continue
+		}
+		total++
+
+		res, err := geocodeAddress(geocoder, v.Adresse, limit, false)
+		if err != nil {
+			routerLogger(v).Warn("échec du géocodage", "address", v.Adresse, "error", err)
+			failures++
+			continue
+		}
+		inv.Cache.put(v.Adresse, res)
+
+		// Décalage si des routeurs déjà traités sont à la même adresse, pour éviter une superposition
+		for _, w := range inv.Routers[:i] {
+			if w.Adresse == res.Label {
+				res.Lat += 0.0001
+			}
+		}
+		if res.Lat == v.Lat && res.Lon == v.Lon && res.Label == v.Adresse {
+			continue
+		}
+
+		relocations = append(relocations, Relocation{v, res, distance(v.Lat, v.Lon, res.Lat, res.Lon)})
+		inv.Routers[i].Lat, inv.Routers[i].Lon, inv.Routers[i].Adresse = res.Lat, res.Lon, res.Label
+	}
+
+	// Rapport
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if len(relocations) > 0 {
+		fmt.Fprintln(w, "IP\tADRESSE\tANCIENNES COORDONNÉES\tNOUVELLES COORDONNÉES\tÉCART")
+		for _, v := range relocations {
+			addr := v.Result.Label
+			if v.Router.Adresse != v.Result.Label {
+				addr = v.Router.Adresse + " -> " + v.Result.Label
+			}
+			fmt.Fprintf(w, "%s\t%s\t%f, %f\t%f, %f\t%.0f m\n", v.Router.IP, addr, v.Router.Lat, v.Router.Lon, v.Result.Lat, v.Result.Lon, v.Distance)
+		}
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintf(w, "%d routeur(s) corrigé(s), %d échec(s) sur %d adresse(s).\n", len(relocations), failures, total)
+	w.Flush()
+
+	switch {
+	case dryRun:
+		fmt.Println("--dry-run: aucun fichier modifié.")
+	case len(relocations) > 0 && !yes && !confirm():
+		fmt.Println("Modifications annulées.")
+	default:
+		if err := inv.save(); err != nil {
+			return err
+		}
+		for _, v := range relocations {
+			routerLogger(v.Router).Info("routeur déplacé", "address", v.Result.Label, "distance", math.Round(v.Distance))
+		}
+	}
+
+	if failures > 0 {
+		return fmt.Errorf("%d adresse(s) non géocodée(s)", failures)
+	}
+
+	return nil
+}
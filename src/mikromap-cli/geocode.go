@@ -0,0 +1,670 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Configuration du géocodage des adresses postales (section geocoding de mikromap.json).
+type GeocodingConfig struct {
+	Providers  []string               `json:"providers"`  // Services essayés dans l'ordre jusqu'au premier résultat fiable (défaut: ban)
+	UserAgent  string                 `json:"user_agent"` // En-tête User-Agent des requêtes (Nominatim demande d'identifier l'application)
+	Candidates int                    `json:"candidates"` // Nombre de résultats demandés à chaque service et proposés dans l'invite interactive (défaut: 5)
+	BAN        ProviderConfig         `json:"ban"`
+	Nominatim  ProviderConfig         `json:"nominatim"`
+	Photon     ProviderConfig         `json:"photon"`
+	Static     map[string]StaticPlace `json:"static"` // Adresse -> coordonnées, pour les sites absents des bases d'adresses
+}
+
+// Configuration d'un service de géocodage en ligne.
+type ProviderConfig struct {
+	URL       string   `json:"url"`       // URL de base du service (défaut: service public, voir newGeocoder), ou d'une instance hébergée
+	Countries []string `json:"countries"` // Codes pays ISO 3166-1 alpha-2 auxquels limiter la recherche (Nominatim uniquement, optionnel)
+	MinScore  float64  `json:"min_score"` // Score minimum d'un résultat fiable, entre 0 et 1 (défaut: 0.5 pour ban, 0 sinon)
+	Rate      float64  `json:"rate"`      // Nombre maximum d'appels par seconde (défaut: 1 pour nominatim, 10 sinon)
+}
+
+// Coordonnées d'une adresse de la table statique.
+type StaticPlace struct {
+	Lat   float64 `json:"lat"`
+	Lon   float64 `json:"lon"`
+	Label string  `json:"label"` // Adresse enregistrée dans routers.json (défaut: l'adresse telle que saisie dans la table)
+}
+
+// Résultat d'un géocodage.
+type GeoResult struct {
+	Lat      float64
+	Lon      float64
+	Label    string  // Adresse normalisée renvoyée par le service
+	Score    float64 // Pertinence du résultat entre 0 et 1 (score BAN, importance Nominatim), -1 si le service n'en fournit pas
+	Source   string  // Nom du service
+	Reliable bool    // Score supérieur ou égal au minimum configuré pour le service
+}
+
+// Service de géocodage: renvoie les résultats possibles pour une adresse postale, du plus pertinent au moins pertinent,
+// et l'adresse la plus proche de coordonnées (géocodage inverse).
+type Geocoder interface {
+	Name() string
+	Geocode(addr string, limit int) ([]GeoResult, error)
+	Reverse(lat float64, lon float64) (GeoResult, error)
+}
+
+// Erreur renvoyée par un service de géocodage qui n'a pas trouvé l'adresse.
+var errAddressNotFound = errors.New("adresse introuvable")
+
+// Erreur renvoyée en mode non interactif si aucun résultat n'atteint le score minimum.
+var errUnreliable = errors.New("résultat de géocodage peu fiable")
+
+// URL par défaut des services en ligne.
+const (
+	banURL       = "https://api-adresse.data.gouv.fr"
+	nominatimURL = "https://nominatim.openstreetmap.org"
+	photonURL    = "https://photon.komoot.io"
+)
+
+// Crée le service de géocodage décrit par la configuration.
+// Prend en entrée la configuration (GeocodingConfig) et renvoie le service (Geocoder) ou une erreur (errUsage) si un service est inconnu.
+// Si plusieurs services sont configurés, ils sont essayés dans l'ordre (voir GeocoderChain).
+func newGeocoder(conf GeocodingConfig) (Geocoder, error) {
+
+	client := geoClient{http: &http.Client{Timeout: time.Second * 10}, userAgent: conf.UserAgent}
+	if client.userAgent == "" {
+		client.userAgent = "mikromap-cli"
+	}
+
+	providers := conf.Providers
+	if len(providers) == 0 {
+		providers = []string{"ban"}
+	}
+
+	var chain GeocoderChain
+	for _, name := range providers {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "ban":
+			chain = append(chain, BANGeocoder{client.limit(conf.BAN.Rate, 10), withDefault(conf.BAN.URL, banURL), conf.BAN.MinScore})
+		case "nominatim":
+			chain = append(chain, NominatimGeocoder{client.limit(conf.Nominatim.Rate, 1), withDefault(conf.Nominatim.URL, nominatimURL), conf.Nominatim.Countries, conf.Nominatim.MinScore})
+		case "photon":
+			chain = append(chain, PhotonGeocoder{client.limit(conf.Photon.Rate, 10), withDefault(conf.Photon.URL, photonURL), conf.Photon.MinScore})
+		case "static":
+			chain = append(chain, newStaticGeocoder(conf.Static))
+		default:
+			return nil, fmt.Errorf("%w: service de géocodage inconnu '%s' (attendu: ban, nominatim, photon, static)", errUsage, name)
+		}
+	}
+	if len(chain) == 1 {
+		return chain[0], nil
+	}
+
+	return chain, nil
+}
+
+// Renvoie une valeur, ou la valeur par défaut si elle est vide.
+// Prend en entrée la valeur (string) et la valeur par défaut (string), renvoie la valeur retenue (string).
+func withDefault(value string, def string) string {
+
+	if value == "" {
+		return def
+	}
+	return value
+}
+
+// Client HTTP partagé par les services de géocodage en ligne.
+type geoClient struct {
+	http      *http.Client
+	userAgent string
+	interval  time.Duration // Délai minimum entre deux appels au service (voir geoClient.limit)
+}
+
+// Limite du nombre d'appels par seconde imposée à tous les services par l'option --rate d'import et regeocode (0: limite de chaque service).
+var maxGeoRate float64
+
+// Date à laquelle le prochain appel à chaque service est autorisé (URL de base -> date).
+// Partagée par tous les clients, pour que la limite s'applique à l'ensemble des appels d'une commande.
+var geoThrottle = struct {
+	sync.Mutex
+	next map[string]time.Time
+}{next: make(map[string]time.Time)}
+
+// Renvoie une copie du client limitée à un nombre d'appels par seconde.
+// Méthode de geoClient. Prend en entrée la limite configurée (float64, 0 pour la limite par défaut) et la limite par défaut du service (float64),
+// renvoie le client limité (geoClient). La limite de l'option --rate (maxGeoRate) s'applique si elle est plus basse.
+func (client geoClient) limit(rate float64, def float64) geoClient {
+
+	if rate <= 0 {
+		rate = def
+	}
+	if maxGeoRate > 0 && maxGeoRate < rate {
+		rate = maxGeoRate
+	}
+	client.interval = time.Duration(float64(time.Second) / rate)
+
+	return client
+}
+
+// Attend que le prochain appel à un service respecte sa limite de débit.
+// Méthode de geoClient. Prend en entrée l'URL de base du service (string) et ne renvoie rien.
+func (client geoClient) wait(baseURL string) {
+
+	geoThrottle.Lock()
+	now := time.Now()
+	at := geoThrottle.next[baseURL]
+	if at.Before(now) {
+		at = now
+	}
+	geoThrottle.next[baseURL] = at.Add(client.interval)
+	geoThrottle.Unlock()
+
+	time.Sleep(time.Until(at))
+}
+
+// Fait un appel GET à un service de géocodage.
+// Méthode de geoClient. Prend en entrée l'URL de base (string), le chemin (string) et les paramètres (url.Values),
+// renvoie le corps de la réponse ([]byte) ou une erreur si le service est injoignable ou ne renvoie pas un 200.
+// L'appel attend si besoin pour respecter la limite de débit du service.
+func (client geoClient) get(baseURL string, path string, params url.Values) ([]byte, error) {
+
+	client.wait(baseURL)
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(baseURL, "/")+path+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", client.userAgent)
+
+	resp, err := client.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("erreur lors de l'appel à l'API de géocodage: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("erreur lors du traitement de la réponse de l'API de géocodage: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("l'API de géocodage a renvoyé le statut %d", resp.StatusCode)
+	}
+
+	return body, nil
+}
+
+// Complète les résultats d'un service avec son nom et leur fiabilité.
+// Prend en entrée les résultats ([]GeoResult), le nom du service (string) et le score minimum (float64, 0 pour tout accepter),
+// renvoie les résultats complétés ([]GeoResult) ou errAddressNotFound s'il n'y en a aucun.
+func rate(results []GeoResult, source string, minScore float64) ([]GeoResult, error) {
+
+	if len(results) == 0 {
+		return nil, errAddressNotFound
+	}
+	for i := range results {
+		results[i].Source = source
+		results[i].Reliable = minScore <= 0 || results[i].Score >= minScore
+	}
+
+	return results, nil
+}
+
+// Réponse GeoJSON des API BAN et Photon. On peut omettre les champs inutiles.
+type geoJSON struct {
+	Features []struct {
+		Geometry struct {
+			Coordinates []float64 `json:"coordinates"` // Longitude, latitude
+		} `json:"geometry"`
+		Properties map[string]any `json:"properties"`
+	} `json:"features"`
+}
+
+// Lit une réponse GeoJSON.
+// Prend en entrée le corps de la réponse ([]byte) et la fonction qui construit l'adresse et le score (-1 si absent) à partir des propriétés d'un résultat,
+// renvoie les résultats ([]GeoResult, sans les résultats sans coordonnées) ou une erreur si la réponse est illisible.
+func parseGeoJSON(data []byte, describe func(map[string]any) (string, float64)) ([]GeoResult, error) {
+
+	var target geoJSON
+	err := json.Unmarshal(data, &target)
+	if err != nil {
+		return nil, fmt.Errorf("réponse de l'API de géocodage illisible: %w", err)
+	}
+
+	var res []GeoResult
+	for _, feature := range target.Features {
+		if len(feature.Geometry.Coordinates) < 2 {
+			continue
+		}
+		label, score := describe(feature.Properties)
+		res = append(res, GeoResult{Lat: feature.Geometry.Coordinates[1], Lon: feature.Geometry.Coordinates[0], Label: label, Score: score})
+	}
+
+	return res, nil
+}
+
+// Renvoie une propriété texte d'un résultat GeoJSON.
+// Prend en entrée les propriétés (map[string]any) et le nom de la propriété (string), renvoie la valeur (string, vide si absente).
+func geoProperty(properties map[string]any, name string) string {
+
+	value, _ := properties[name].(string)
+	return value
+}
+
+// API Adresse du gouvernement (Base Adresse Nationale): gratuite, couvre la France uniquement (50 appels/IP/sec).
+// Voir https://adresse.data.gouv.fr/outils/api-doc/adresse
+type BANGeocoder struct {
+	client   geoClient
+	url      string
+	minScore float64
+}
+
+// Méthode de BANGeocoder, voir Geocoder.
+func (geocoder BANGeocoder) Name() string {
+	return "ban"
+}
+
+// Méthode de BANGeocoder, voir Geocoder.
+func (geocoder BANGeocoder) Geocode(addr string, limit int) ([]GeoResult, error) {
+
+	body, err := geocoder.client.get(geocoder.url, "/search/", url.Values{"q": {addr}, "limit": {strconv.Itoa(limit)}})
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := parseGeoJSON(body, func(properties map[string]any) (string, float64) {
+		score, ok := properties["score"].(float64)
+		if !ok {
+			score = -1
+		}
+		return geoProperty(properties, "label"), score
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return rate(res, geocoder.Name(), geocoder.minScore)
+}
+
+// Méthode de BANGeocoder, voir Geocoder.
+func (geocoder BANGeocoder) Reverse(lat float64, lon float64) (GeoResult, error) {
+
+	body, err := geocoder.client.get(geocoder.url, "/reverse/", coordsParams(lat, lon))
+	if err != nil {
+		return GeoResult{}, err
+	}
+
+	res, err := parseGeoJSON(body, func(properties map[string]any) (string, float64) {
+		return geoProperty(properties, "label"), -1
+	})
+	if err != nil {
+		return GeoResult{}, err
+	}
+	res, err = rate(res, geocoder.Name(), 0)
+	if err != nil {
+		return GeoResult{}, err
+	}
+
+	return res[0], nil
+}
+
+// Renvoie les paramètres d'une requête de géocodage inverse.
+// Prend en entrée latitude (float64) et longitude (float64), renvoie les paramètres lat et lon (url.Values).
+func coordsParams(lat float64, lon float64) url.Values {
+
+	return url.Values{"lat": {strconv.FormatFloat(lat, 'f', -1, 64)}, "lon": {strconv.FormatFloat(lon, 'f', -1, 64)}}
+}
+
+// API Photon (données OpenStreetMap): couvre le monde entier, sans limite de pays. Ne renvoie pas de score.
+// Voir https://photon.komoot.io
+type PhotonGeocoder struct {
+	client   geoClient
+	url      string
+	minScore float64
+}
+
+// Méthode de PhotonGeocoder, voir Geocoder.
+func (geocoder PhotonGeocoder) Name() string {
+	return "photon"
+}
+
+// Méthode de PhotonGeocoder, voir Geocoder.
+func (geocoder PhotonGeocoder) Geocode(addr string, limit int) ([]GeoResult, error) {
+
+	body, err := geocoder.client.get(geocoder.url, "/api/", url.Values{"q": {addr}, "limit": {strconv.Itoa(limit)}})
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := parseGeoJSON(body, photonLabel)
+	if err != nil {
+		return nil, err
+	}
+
+	return rate(res, geocoder.Name(), geocoder.minScore)
+}
+
+// Méthode de PhotonGeocoder, voir Geocoder.
+func (geocoder PhotonGeocoder) Reverse(lat float64, lon float64) (GeoResult, error) {
+
+	body, err := geocoder.client.get(geocoder.url, "/reverse", coordsParams(lat, lon))
+	if err != nil {
+		return GeoResult{}, err
+	}
+
+	res, err := parseGeoJSON(body, photonLabel)
+	if err != nil {
+		return GeoResult{}, err
+	}
+	res, err = rate(res, geocoder.Name(), 0)
+	if err != nil {
+		return GeoResult{}, err
+	}
+
+	return res[0], nil
+}
+
+// Construit l'adresse d'un résultat Photon, qui ne renvoie pas d'adresse complète.
+// Prend en entrée les propriétés du résultat (map[string]any) et renvoie l'adresse (string), reconstruite à partir du numéro,
+// de la rue (ou du nom du lieu), du code postal, de la ville et du pays, et le score (float64, toujours -1).
+func photonLabel(properties map[string]any) (string, float64) {
+
+	street := strings.TrimSpace(geoProperty(properties, "housenumber") + " " + geoProperty(properties, "street"))
+	if street == "" {
+		street = geoProperty(properties, "name")
+	}
+	city := strings.TrimSpace(geoProperty(properties, "postcode") + " " + geoProperty(properties, "city"))
+
+	var parts []string
+	for _, v := range []string{street, city, geoProperty(properties, "country")} {
+		if v != "" {
+			parts = append(parts, v)
+		}
+	}
+
+	return strings.Join(parts, ", "), -1
+}
+
+// API Nominatim (données OpenStreetMap): couvre le monde entier. Le score est l'importance du lieu, pas la qualité de la correspondance.
+// Le service public est limité à 1 appel par seconde et demande un User-Agent identifiant l'application.
+// Voir https://nominatim.org/release-docs/latest/api/Search/
+type NominatimGeocoder struct {
+	client    geoClient
+	url       string
+	countries []string
+	minScore  float64
+}
+
+// Méthode de NominatimGeocoder, voir Geocoder.
+func (geocoder NominatimGeocoder) Name() string {
+	return "nominatim"
+}
+
+// Méthode de NominatimGeocoder, voir Geocoder.
+func (geocoder NominatimGeocoder) Geocode(addr string, limit int) ([]GeoResult, error) {
+
+	params := url.Values{"q": {addr}, "format": {"jsonv2"}, "limit": {strconv.Itoa(limit)}}
+	if len(geocoder.countries) > 0 {
+		params.Set("countrycodes", strings.ToLower(strings.Join(geocoder.countries, ",")))
+	}
+	body, err := geocoder.client.get(geocoder.url, "/search", params)
+	if err != nil {
+		return nil, err
+	}
+
+	// Les coordonnées sont renvoyées sous forme de texte
+	var target []struct {
+		Lat         string  `json:"lat"`
+		Lon         string  `json:"lon"`
+		DisplayName string  `json:"display_name"`
+		Importance  float64 `json:"importance"`
+	}
+	err = json.Unmarshal(body, &target)
+	if err != nil {
+		return nil, fmt.Errorf("réponse de l'API de géocodage illisible: %w", err)
+	}
+
+	var res []GeoResult
+	for _, v := range target {
+		lat, err := strconv.ParseFloat(v.Lat, 64)
+		if err != nil {
+			return nil, fmt.Errorf("latitude illisible '%s': %w", v.Lat, err)
+		}
+		lon, err := strconv.ParseFloat(v.Lon, 64)
+		if err != nil {
+			return nil, fmt.Errorf("longitude illisible '%s': %w", v.Lon, err)
+		}
+		res = append(res, GeoResult{Lat: lat, Lon: lon, Label: v.DisplayName, Score: v.Importance})
+	}
+
+	return rate(res, geocoder.Name(), geocoder.minScore)
+}
+
+// Méthode de NominatimGeocoder, voir Geocoder.
+func (geocoder NominatimGeocoder) Reverse(lat float64, lon float64) (GeoResult, error) {
+
+	params := coordsParams(lat, lon)
+	params.Set("format", "jsonv2")
+	body, err := geocoder.client.get(geocoder.url, "/reverse", params)
+	if err != nil {
+		return GeoResult{}, err
+	}
+
+	// Un lieu, ou un message d'erreur si aucun lieu n'est proche
+	var target struct {
+		DisplayName string `json:"display_name"`
+		Error       string `json:"error"`
+	}
+	err = json.Unmarshal(body, &target)
+	if err != nil {
+		return GeoResult{}, fmt.Errorf("réponse de l'API de géocodage illisible: %w", err)
+	}
+	if target.DisplayName == "" {
+		return GeoResult{}, errAddressNotFound
+	}
+
+	return GeoResult{Lat: lat, Lon: lon, Label: target.DisplayName, Score: -1, Source: geocoder.Name(), Reliable: true}, nil
+}
+
+// Table statique d'adresses, définie dans mikromap.json.
+// Les adresses sont comparées sans tenir compte de la casse ni des espaces superflus.
+type StaticGeocoder map[string]GeoResult
+
+// Crée la table statique à partir de la configuration. Chaque lieu est aussi indexé par son label,
+// qui est l'adresse enregistrée dans routers.json (voir regeocode).
+// Prend en entrée les adresses (map adresse -> StaticPlace) et renvoie la table (StaticGeocoder).
+func newStaticGeocoder(places map[string]StaticPlace) StaticGeocoder {
+
+	table := make(StaticGeocoder)
+	for addr, place := range places {
+		label := place.Label
+		if label == "" {
+			label = strings.Join(strings.Fields(addr), " ")
+		}
+		res := GeoResult{Lat: place.Lat, Lon: place.Lon, Label: label, Score: 1, Source: "static", Reliable: true}
+		table[normalizeAddress(addr)] = res
+		if _, ok := table[normalizeAddress(label)]; !ok {
+			table[normalizeAddress(label)] = res
+		}
+	}
+
+	return table
+}
+
+// Normalise une adresse pour la comparer à d'autres.
+// Prend en entrée l'adresse (string) et la renvoie en minuscules, sans espaces superflus (string).
+func normalizeAddress(addr string) string {
+	return strings.ToLower(strings.Join(strings.Fields(addr), " "))
+}
+
+// Méthode de StaticGeocoder, voir Geocoder.
+func (geocoder StaticGeocoder) Name() string {
+	return "static"
+}
+
+// Méthode de StaticGeocoder, voir Geocoder.
+// Les adresses de la table sont toujours fiables (score 1).
+func (geocoder StaticGeocoder) Geocode(addr string, limit int) ([]GeoResult, error) {
+
+	res, ok := geocoder[normalizeAddress(addr)]
+	if !ok {
+		return nil, errAddressNotFound
+	}
+
+	return []GeoResult{res}, nil
+}
+
+// Méthode de StaticGeocoder, voir Geocoder.
+// Renvoie l'adresse de la table dont les coordonnées sont identiques à 4 décimales près (une dizaine de mètres).
+func (geocoder StaticGeocoder) Reverse(lat float64, lon float64) (GeoResult, error) {
+
+	for _, v := range geocoder {
+		if math.Abs(v.Lat-lat) < 0.00005 && math.Abs(v.Lon-lon) < 0.00005 {
+			return v, nil
+		}
+	}
+
+	return GeoResult{}, errAddressNotFound
+}
+
+// Services de géocodage essayés dans l'ordre: le premier qui renvoie un résultat fiable l'emporte.
+// Un service injoignable, qui ne trouve pas l'adresse ou dont aucun résultat n'est fiable passe la main au suivant.
+type GeocoderChain []Geocoder
+
+// Méthode de GeocoderChain, voir Geocoder.
+func (chain GeocoderChain) Name() string {
+
+	var names []string
+	for _, v := range chain {
+		names = append(names, v.Name())
+	}
+	return strings.Join(names, ", ")
+}
+
+// Méthode de GeocoderChain, voir Geocoder.
+// Si aucun service ne renvoie de résultat fiable, renvoie les résultats du premier service qui en a trouvé.
+// Renvoie errAddressNotFound si aucun service n'a trouvé l'adresse, ou les erreurs de chaque service si l'un d'eux a échoué.
+func (chain GeocoderChain) Geocode(addr string, limit int) ([]GeoResult, error) {
+
+	var errs []string
+	var first []GeoResult
+	notFound := true
+	for _, geocoder := range chain {
+		res, err := geocoder.Geocode(addr, limit)
+		if err != nil {
+			logger.Debug("échec du géocodage, service suivant", "geocoder", geocoder.Name(), "address", addr, "error", err)
+			errs = append(errs, geocoder.Name()+": "+err.Error())
+			notFound = notFound && errors.Is(err, errAddressNotFound)
+			continue
+		}
+		if res[0].Reliable {
+			logger.Debug("adresse géocodée", "geocoder", geocoder.Name(), "address", addr, "label", res[0].Label, "score", res[0].Score)
+			return res, nil
+		}
+		logger.Debug("aucun résultat fiable, service suivant", "geocoder", geocoder.Name(), "address", addr, "label", res[0].Label, "score", res[0].Score)
+		if first == nil {
+			first = res
+		}
+	}
+
+	if first != nil {
+		return first, nil
+	}
+	if notFound {
+		return nil, fmt.Errorf("%w (%s)", errAddressNotFound, chain.Name())
+	}
+	return nil, errors.New(strings.Join(errs, "; "))
+}
+
+// Méthode de GeocoderChain, voir Geocoder.
+// Renvoie l'adresse trouvée par le premier service qui répond, ou les erreurs de chaque service.
+func (chain GeocoderChain) Reverse(lat float64, lon float64) (GeoResult, error) {
+
+	var errs []string
+	for _, geocoder := range chain {
+		res, err := geocoder.Reverse(lat, lon)
+		if err == nil {
+			return res, nil
+		}
+		logger.Debug("échec du géocodage inverse, service suivant", "geocoder", geocoder.Name(), "lat", lat, "lon", lon, "error", err)
+		errs = append(errs, geocoder.Name()+": "+err.Error())
+	}
+
+	return GeoResult{}, errors.New(strings.Join(errs, "; "))
+}
+
+// Géocode une adresse et retient un des résultats.
+// Prend en entrée le service (Geocoder), l'adresse (string), le nombre de résultats demandés (int) et si l'utilisateur peut choisir (bool),
+// renvoie le résultat retenu (GeoResult) ou une erreur.
+// Sans choix, le premier résultat est retenu s'il est fiable (errUnreliable sinon). Avec choix, les résultats sont affichés avec leur score
+// et l'utilisateur en choisit un ou saisit une autre adresse.
+func geocodeAddress(geocoder Geocoder, addr string, limit int, choose bool) (GeoResult, error) {
+
+	for {
+		res, err := geocoder.Geocode(addr, limit)
+		if !choose {
+			if err != nil {
+				return GeoResult{}, err
+			}
+			if !res[0].Reliable {
+				return GeoResult{}, fmt.Errorf("%w: '%s' (%s, score %s)", errUnreliable, res[0].Label, res[0].Source, formatScore(res[0].Score))
+			}
+			return res[0], nil
+		}
+		if err != nil && !errors.Is(err, errAddressNotFound) {
+			return GeoResult{}, err
+		}
+
+		// Affichage des résultats
+		label := "\033[33mNuméro du résultat (vide pour 1), ou autre adresse >> \033[0m"
+		if len(res) == 0 {
+			fmt.Printf("Aucun résultat pour '%s'.\n", addr)
+			label = "\033[33mAutre adresse (vide pour annuler) >> \033[0m"
+		} else {
+			fmt.Printf("--- Résultats pour '%s'\n", addr)
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			for i, v := range res {
+				warning := ""
+				if !v.Reliable {
+					warning = "\033[31mpeu fiable\033[0m"
+				}
+				fmt.Fprintf(w, "%d)\t%s\t%s\t%s\t%s\n", i+1, v.Label, v.Source, formatScore(v.Score), warning)
+			}
+			w.Flush()
+		}
+
+		// Choix d'un résultat ou nouvelle saisie
+		answer, err := prompt(label)
+		if err != nil {
+			return GeoResult{}, err
+		}
+		switch n, err := strconv.Atoi(answer); {
+		case answer == "" && len(res) == 0:
+			return GeoResult{}, fmt.Errorf("%w: %s", errAddressNotFound, addr)
+		case answer == "":
+			return res[0], nil
+		case err == nil && n >= 1 && n <= len(res):
+			return res[n-1], nil
+		case err == nil && len(res) > 0:
+			fmt.Printf("Choix invalide: %d (attendu: 1 à %d)\n", n, len(res))
+		default:
+			addr = answer
+		}
+	}
+}
+
+// Formate le score d'un résultat de géocodage.
+// Prend en entrée le score (float64) et renvoie le texte à afficher (string, - si le service ne fournit pas de score).
+func formatScore(score float64) string {
+
+	if score < 0 {
+		return "-"
+	}
+	return strconv.FormatFloat(score, 'f', 2, 64)
+}
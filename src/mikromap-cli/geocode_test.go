@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Démarre un service de géocodage de test qui répond toujours le même statut et le même corps.
+// Prend en entrée le test (*testing.T), le statut (int) et le corps (string), renvoie le serveur (*httptest.Server)
+// et la dernière requête reçue (*http.Request, mise à jour à chaque appel).
+func geoServer(t *testing.T, status int, body string) (*httptest.Server, *http.Request) {
+
+	var last http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		last = *r
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &last
+}
+
+// Service de géocodage de test pour GeocoderChain.
+type fakeGeocoder struct {
+	name string
+	res  []GeoResult
+	err  error
+}
+
+func (geocoder fakeGeocoder) Name() string { return geocoder.name }
+
+func (geocoder fakeGeocoder) Geocode(addr string, limit int) ([]GeoResult, error) {
+	return geocoder.res, geocoder.err
+}
+
+func (geocoder fakeGeocoder) Reverse(lat float64, lon float64) (GeoResult, error) {
+	if geocoder.err != nil {
+		return GeoResult{}, geocoder.err
+	}
+	return geocoder.res[0], nil
+}
+
+func TestBANGeocoder(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   []GeoResult
+		err    error // Erreur attendue (errors.Is), errTest pour une erreur quelconque
+	}{
+		{"résultats", 200, `{"features": [
+			{"geometry": {"coordinates": [4.39, 45.43]}, "properties": {"label": "1 Rue du Général Leclerc 42100 Saint-Étienne", "score": 0.9}},
+			{"geometry": {"coordinates": [4.4, 45.4]}, "properties": {"label": "Rue Leclerc 42000 Saint-Étienne", "score": 0.3}},
+			{"geometry": {"coordinates": []}, "properties": {"label": "sans coordonnées", "score": 0.9}}]}`,
+			[]GeoResult{
+				{Lat: 45.43, Lon: 4.39, Label: "1 Rue du Général Leclerc 42100 Saint-Étienne", Score: 0.9, Source: "ban", Reliable: true},
+				{Lat: 45.4, Lon: 4.4, Label: "Rue Leclerc 42000 Saint-Étienne", Score: 0.3, Source: "ban", Reliable: false},
+			}, nil},
+		{"sans score", 200, `{"features": [{"geometry": {"coordinates": [4.39, 45.43]}, "properties": {"label": "A"}}]}`,
+			[]GeoResult{{Lat: 45.43, Lon: 4.39, Label: "A", Score: -1, Source: "ban", Reliable: false}}, nil},
+		{"aucun résultat", 200, `{"type": "FeatureCollection", "features": []}`, nil, errAddressNotFound},
+		{"statut 503", 503, `{"features": []}`, nil, errTest},
+		{"réponse illisible", 200, `<html>`, nil, errTest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, req := geoServer(t, tt.status, tt.body)
+			geocoder := BANGeocoder{geoClient{http: server.Client(), userAgent: "test"}, server.URL + "/", 0.5}
+
+			res, err := geocoder.Geocode("1 rue leclerc st etienne", 3)
+			checkGeoError(t, err, tt.err)
+			if !reflect.DeepEqual(res, tt.want) {
+				t.Errorf("résultats = %+v, attendu %+v", res, tt.want)
+			}
+			if req.URL.Path != "/search/" || req.URL.Query().Get("q") != "1 rue leclerc st etienne" || req.URL.Query().Get("limit") != "3" {
+				t.Errorf("requête = %s", req.URL)
+			}
+			if req.Header.Get("User-Agent") != "test" {
+				t.Errorf("User-Agent = %q", req.Header.Get("User-Agent"))
+			}
+		})
+	}
+}
+
+func TestNominatimGeocoder(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   []GeoResult
+		err    error
+	}{
+		{"coordonnées en texte", 200, `[
+			{"lat": "50.8467", "lon": "4.3525", "display_name": "Grand-Place, Bruxelles, Belgique", "importance": 0.6},
+			{"lat": "46.2044", "lon": "6.1432", "display_name": "Genève, Suisse", "importance": 0.1}]`,
+			[]GeoResult{
+				{Lat: 50.8467, Lon: 4.3525, Label: "Grand-Place, Bruxelles, Belgique", Score: 0.6, Source: "nominatim", Reliable: true},
+				{Lat: 46.2044, Lon: 6.1432, Label: "Genève, Suisse", Score: 0.1, Source: "nominatim", Reliable: false},
+			}, nil},
+		{"aucun résultat", 200, `[]`, nil, errAddressNotFound},
+		{"latitude illisible", 200, `[{"lat": "nord", "lon": "4.3525", "display_name": "A"}]`, nil, errTest},
+		{"statut 429", 429, `[]`, nil, errTest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, req := geoServer(t, tt.status, tt.body)
+			geocoder := NominatimGeocoder{geoClient{http: server.Client()}, server.URL, []string{"BE", "ch"}, 0.5}
+
+			res, err := geocoder.Geocode("grand place bruxelles", 2)
+			checkGeoError(t, err, tt.err)
+			if !reflect.DeepEqual(res, tt.want) {
+				t.Errorf("résultats = %+v, attendu %+v", res, tt.want)
+			}
+			query := req.URL.Query()
+			if req.URL.Path != "/search" || query.Get("format") != "jsonv2" || query.Get("countrycodes") != "be,ch" {
+				t.Errorf("requête = %s", req.URL)
+			}
+		})
+	}
+
+	// Géocodage inverse: un lieu, ou un message d'erreur si aucun lieu n'est proche
+	server, _ := geoServer(t, 200, `{"display_name": "Grand-Place, Bruxelles, Belgique"}`)
+	res, err := NominatimGeocoder{client: geoClient{http: server.Client()}, url: server.URL}.Reverse(50.8467, 4.3525)
+	if err != nil || res.Label != "Grand-Place, Bruxelles, Belgique" || res.Lat != 50.8467 || res.Source != "nominatim" {
+		t.Errorf("Reverse = %+v, %v", res, err)
+	}
+	server, _ = geoServer(t, 200, `{"error": "Unable to geocode"}`)
+	_, err = NominatimGeocoder{client: geoClient{http: server.Client()}, url: server.URL}.Reverse(0, 0)
+	checkGeoError(t, err, errAddressNotFound)
+}
+
+func TestPhotonGeocoder(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   []GeoResult
+		err    error
+	}{
+		{"adresse reconstruite", 200, `{"features": [
+			{"geometry": {"coordinates": [4.39, 45.43]}, "properties": {"housenumber": "1", "street": "Rue Leclerc", "postcode": "42100", "city": "Saint-Étienne", "country": "France"}},
+			{"geometry": {"coordinates": [6.14, 46.2]}, "properties": {"name": "Genève", "country": "Suisse"}}]}`,
+			[]GeoResult{
+				{Lat: 45.43, Lon: 4.39, Label: "1 Rue Leclerc, 42100 Saint-Étienne, France", Score: -1, Source: "photon", Reliable: true},
+				{Lat: 46.2, Lon: 6.14, Label: "Genève, Suisse", Score: -1, Source: "photon", Reliable: true},
+			}, nil},
+		{"aucun résultat", 200, `{"features": []}`, nil, errAddressNotFound},
+		{"statut 500", 500, `{"message": "erreur"}`, nil, errTest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, req := geoServer(t, tt.status, tt.body)
+			geocoder := PhotonGeocoder{geoClient{http: server.Client()}, server.URL, 0}
+
+			res, err := geocoder.Geocode("1 rue leclerc st etienne", 5)
+			checkGeoError(t, err, tt.err)
+			if !reflect.DeepEqual(res, tt.want) {
+				t.Errorf("résultats = %+v, attendu %+v", res, tt.want)
+			}
+			if req.URL.Path != "/api/" {
+				t.Errorf("requête = %s", req.URL)
+			}
+		})
+	}
+}
+
+func TestStaticGeocoder(t *testing.T) {
+
+	geocoder := newStaticGeocoder(map[string]StaticPlace{
+		"Pylône col du Grand Bois": {Lat: 45.3089, Lon: 4.4631, Label: "Pylône, Col du Grand Bois 42220 Saint-Sauveur-en-Rue"},
+		"  Relais   Pilat ":        {Lat: 45.36, Lon: 4.58},
+	})
+
+	tests := []struct {
+		addr  string
+		label string // Vide si l'adresse est absente de la table
+	}{
+		{"Pylône col du Grand Bois", "Pylône, Col du Grand Bois 42220 Saint-Sauveur-en-Rue"},
+		{"  PYLÔNE   col du grand bois ", "Pylône, Col du Grand Bois 42220 Saint-Sauveur-en-Rue"},
+		{"pylône, col du grand bois 42220 saint-sauveur-en-rue", "Pylône, Col du Grand Bois 42220 Saint-Sauveur-en-Rue"},
+		{"relais pilat", "Relais Pilat"},
+		{"col du grand bois", ""},
+	}
+	for _, tt := range tests {
+		res, err := geocoder.Geocode(tt.addr, 5)
+		if tt.label == "" {
+			if !errors.Is(err, errAddressNotFound) {
+				t.Errorf("Geocode(%q) = %v, %v, attendu errAddressNotFound", tt.addr, res, err)
+			}
+			continue
+		}
+		if err != nil || len(res) != 1 || res[0].Label != tt.label || !res[0].Reliable || res[0].Source != "static" {
+			t.Errorf("Geocode(%q) = %+v, %v, attendu %q", tt.addr, res, err, tt.label)
+		}
+	}
+
+	if res, err := geocoder.Reverse(45.30891, 4.46309); err != nil || res.Label != "Pylône, Col du Grand Bois 42220 Saint-Sauveur-en-Rue" {
+		t.Errorf("Reverse = %+v, %v", res, err)
+	}
+	if _, err := geocoder.Reverse(45.3095, 4.4631); !errors.Is(err, errAddressNotFound) {
+		t.Errorf("Reverse à 60 m = %v, attendu errAddressNotFound", err)
+	}
+}
+
+func TestGeocoderChain(t *testing.T) {
+
+	reliable := []GeoResult{{Label: "fiable", Source: "b", Reliable: true}}
+	unreliable := []GeoResult{{Label: "peu fiable", Source: "a", Reliable: false}}
+	errDown := errors.New("service injoignable")
+
+	tests := []struct {
+		name  string
+		chain GeocoderChain
+		label string
+		err   error
+	}{
+		{"erreur puis résultat", GeocoderChain{fakeGeocoder{"a", nil, errDown}, fakeGeocoder{"b", reliable, nil}}, "fiable", nil},
+		{"introuvable puis résultat", GeocoderChain{fakeGeocoder{"a", nil, errAddressNotFound}, fakeGeocoder{"b", reliable, nil}}, "fiable", nil},
+		{"peu fiable puis fiable", GeocoderChain{fakeGeocoder{"a", unreliable, nil}, fakeGeocoder{"b", reliable, nil}}, "fiable", nil},
+		{"premier fiable", GeocoderChain{fakeGeocoder{"b", reliable, nil}, fakeGeocoder{"a", nil, errDown}}, "fiable", nil},
+		{"aucun fiable", GeocoderChain{fakeGeocoder{"a", unreliable, nil}, fakeGeocoder{"b", nil, errAddressNotFound}}, "peu fiable", nil},
+		{"introuvable partout", GeocoderChain{fakeGeocoder{"a", nil, errAddressNotFound}, fakeGeocoder{"b", nil, errAddressNotFound}}, "", errAddressNotFound},
+		{"erreur et introuvable", GeocoderChain{fakeGeocoder{"a", nil, errDown}, fakeGeocoder{"b", nil, errAddressNotFound}}, "", errTest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := tt.chain.Geocode("adresse", 5)
+			checkGeoError(t, err, tt.err)
+			if tt.err == nil && (len(res) == 0 || res[0].Label != tt.label) {
+				t.Errorf("résultats = %+v, attendu %q en premier", res, tt.label)
+			}
+			if tt.err == errTest && (errors.Is(err, errAddressNotFound) || !strings.Contains(err.Error(), "a: service injoignable")) {
+				t.Errorf("erreur = %v, attendu l'erreur de chaque service", err)
+			}
+		})
+	}
+}
+
+func TestNewGeocoderChain(t *testing.T) {
+
+	// ban est en panne, nominatim répond: le résultat vient de nominatim
+	ban, _ := geoServer(t, 502, `Bad Gateway`)
+	nominatim, _ := geoServer(t, 200, `[{"lat": "50.8467", "lon": "4.3525", "display_name": "Grand-Place, Bruxelles", "importance": 0.6}]`)
+	conf := GeocodingConfig{
+		Providers: []string{"static", "BAN", " nominatim "},
+		BAN:       ProviderConfig{URL: ban.URL, Rate: 1000},
+		Nominatim: ProviderConfig{URL: nominatim.URL, Rate: 1000},
+	}
+	geocoder, err := newGeocoder(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if geocoder.Name() != "static, ban, nominatim" {
+		t.Errorf("services = %s", geocoder.Name())
+	}
+	res, err := geocodeAddress(geocoder, "grand place bruxelles", 5, false)
+	if err != nil || res.Source != "nominatim" || res.Lat != 50.8467 {
+		t.Errorf("geocodeAddress = %+v, %v", res, err)
+	}
+
+	if _, err := newGeocoder(GeocodingConfig{Providers: []string{"google"}}); !errors.Is(err, errUsage) {
+		t.Errorf("service inconnu: %v, attendu errUsage", err)
+	}
+}
+
+// Erreur quelconque attendue par les tests de géocodage (voir checkGeoError).
+var errTest = errors.New("erreur attendue")
+
+// Vérifie l'erreur renvoyée par un service de géocodage.
+// Prend en entrée le test (*testing.T), l'erreur obtenue et l'erreur attendue (nil, errTest pour une erreur quelconque, ou une erreur de errors.Is).
+func checkGeoError(t *testing.T, err error, want error) {
+
+	t.Helper()
+	switch {
+	case want == nil && err != nil:
+		t.Errorf("erreur inattendue: %v", err)
+	case want == errTest && err == nil:
+		t.Error("erreur attendue")
+	case want != nil && want != errTest && !errors.Is(err, want):
+		t.Errorf("erreur = %v, attendu %v", err, want)
+	}
+}
+
+func TestGeoClientLimit(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		rate     float64
+		def      float64
+		max      float64
+		interval time.Duration
+	}{
+		{"défaut du service", 0, 1, 0, time.Second},
+		{"limite configurée", 4, 1, 0, time.Second / 4},
+		{"--rate plus bas", 10, 10, 2, time.Second / 2},
+		{"--rate plus haut", 1, 10, 5, time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			maxGeoRate = tt.max
+			t.Cleanup(func() { maxGeoRate = 0 })
+
+			if got := (geoClient{}).limit(tt.rate, tt.def).interval; got != tt.interval {
+				t.Errorf("intervalle = %v, attendu %v", got, tt.interval)
+			}
+		})
+	}
+}
+
+func TestGeoClientThrottle(t *testing.T) {
+
+	var calls []time.Time
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, time.Now())
+	}))
+	defer server.Close()
+
+	// La limite est partagée par deux clients du même service, comme entre deux géocodages d'une même commande
+	interval := 50 * time.Millisecond
+	clients := []geoClient{
+		{http: server.Client(), interval: interval},
+		{http: server.Client(), interval: interval},
+	}
+	for i := 0; i < 4; i++ {
+		if _, err := clients[i%2].get(server.URL, "/", url.Values{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 1; i < len(calls); i++ {
+		if gap := calls[i].Sub(calls[i-1]); gap < interval-5*time.Millisecond {
+			t.Errorf("appels %d et %d espacés de %v, attendu au moins %v", i-1, i, gap, interval)
+		}
+	}
+}
+
+func TestGeocodeCache(t *testing.T) {
+
+	previous := stdin
+	t.Cleanup(func() { stdin = previous })
+
+	tests := []struct {
+		name   string
+		choose bool
+		label  string
+		cached bool // Entrée du cache conservée
+	}{
+		{"sans choix", false, "Ancien résultat", true},
+		{"avec choix", true, "Relais Pilat", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inv := &Inventory{
+				Geocoding: GeocodingConfig{Providers: []string{"static"}, Static: map[string]StaticPlace{"Relais Pilat": {Lat: 45.36, Lon: 4.58}}},
+				Cache:     make(GeoCache),
+			}
+			inv.Cache.put("relais pilat", GeoResult{Lat: 45, Lon: 4, Label: "Ancien résultat", Source: "ban"})
+			stdin = bufio.NewScanner(strings.NewReader("\n")) // Premier résultat proposé
+
+			res, err := inv.geocode("relais pilat", tt.choose)
+			if err != nil || res.Label != tt.label {
+				t.Fatalf("geocode = %+v, %v, attendu %q", res, err, tt.label)
+			}
+			if _, ok := inv.Cache.get("relais pilat"); ok != tt.cached {
+				t.Errorf("entrée du cache conservée: %v, attendu %v", ok, tt.cached)
+			}
+		})
+	}
+}
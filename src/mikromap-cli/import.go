@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Ligne d'un fichier d'import (CSV ou JSON).
+// En CSV, la première ligne contient les noms des colonnes (ip obligatoire, les autres optionnelles, dans n'importe quel ordre).
+// Les colonnes et champs inconnus (ex: visible ou jobs d'un fichier produit par export) sont ignorés.
+type ImportRow struct {
+	Line    int      `json:"-"` // Numéro de ligne (CSV) ou position dans le tableau (JSON), à partir de 1
+	IP      string   `json:"ip"`
+	Address string   `json:"address"`
+	User    string   `json:"user"`
+	Type    string   `json:"type"`
+	Parent  string   `json:"parent"`
+	Lat     *float64 `json:"lat"`
+	Lon     *float64 `json:"lon"`
+}
+
+// Ligne rejetée lors d'un import.
+type ImportFailure struct {
+	Line   int
+	IP     string
+	Reason error
+}
+
+// Colonnes reconnues dans les fichiers CSV.
+var importColumns = []string{"ip", "address", "user", "type", "parent", "lat", "lon"}
+
+// Lit les lignes d'un fichier d'import CSV.
+// Prend en entrée le contenu du fichier ([]byte) et renvoie les lignes ([]ImportRow) ou une erreur (errUsage) si le fichier est mal formé.
+// Le séparateur (virgule ou point-virgule, comme dans les exports Excel français) est déduit de la ligne d'en-tête.
+func parseImportCSV(content []byte) ([]ImportRow, error) {
+
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(content, []byte("\xef\xbb\xbf"))))
+	header, _, _ := bytes.Cut(content, []byte("\n"))
+	if bytes.Count(header, []byte(";")) > bytes.Count(header, []byte(",")) {
+		reader.Comma = ';'
+	}
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%w: fichier CSV illisible: %v", errUsage, err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("%w: fichier CSV vide", errUsage)
+	}
+
+	// Position des colonnes
+	columns := make(map[string]int)
+	for i, name := range records[0] {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !slices.Contains(importColumns, name) {
+			logger.Warn("colonne ignorée", "column", name)
+			continue
+		}
+		columns[name] = i
+	}
+	if _, ok := columns["ip"]; !ok {
+		return nil, fmt.Errorf("%w: colonne 'ip' absente", errUsage)
+	}
+
+	var rows []ImportRow
+	for i, record := range records[1:] {
+		get := func(name string) string {
+			if j, ok := columns[name]; ok && j < len(record) {
+				return strings.TrimSpace(record[j])
+			}
+			return ""
+		}
+
+		// Lignes vides ignorées
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+
+		row := ImportRow{Line: i + 2, IP: get("ip"), Address: get("address"), User: get("user"), Type: get("type"), Parent: get("parent")}
+		for _, c := range []struct {
+			name  string
+			value **float64
+		}{{"lat", &row.Lat}, {"lon", &row.Lon}} {
+			if v := get(c.name); v != "" {
+				f, err := strconv.ParseFloat(strings.Replace(v, ",", ".", 1), 64)
+				if err != nil {
+					return nil, fmt.Errorf("%w: ligne %d: %s invalide '%s'", errUsage, row.Line, c.name, v)
+				}
+				*c.value = &f
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// Lit les lignes d'un fichier d'import JSON (tableau d'objets).
+// Prend en entrée le contenu du fichier ([]byte) et renvoie les lignes ([]ImportRow) ou une erreur (errUsage) si le fichier est mal formé.
+func parseImportJSON(content []byte) ([]ImportRow, error) {
+
+	var rows []ImportRow
+	err := json.Unmarshal(content, &rows)
+	if err != nil {
+		return nil, fmt.Errorf("%w: fichier JSON illisible: %v", errUsage, err)
+	}
+	for i := range rows {
+		rows[i].Line = i + 1
+	}
+
+	return rows, nil
+}
+
+// Importe des routeurs dans l'inventaire (sans écrire les fichiers).
+// Méthode de *Inventory. Prend en entrée les lignes ([]ImportRow) et renvoie les routeurs importés ([]Router) et les lignes rejetées ([]ImportFailure).
+// Toutes les lignes sont d'abord vérifiées, puis les adresses sans coordonnées sont géocodées et les coordonnées sans adresse
+// complétées par géocodage inverse. Un routeur parent doit être dans routers.json
+// ou plus haut dans le fichier. Les routeurs dont le parent est rejeté sont rejetés aussi.
+func (inv *Inventory) importRows(rows []ImportRow) ([]Router, []ImportFailure) {
+
+	var failures []ImportFailure
+	var imported []Router
+	lines := make(map[string]int) // IP -> numéro de ligne
+
+	// Vérification de toutes les lignes
+	for _, row := range rows {
+		router, err := inv.prepareRouter(RouterInput{
+			Target:  row.IP,
+			Address: row.Address,
+			Users:   row.User,
+			Type:    row.Type,
+			Parent:  row.Parent,
+			Lat:     row.Lat,
+			Lon:     row.Lon,
+		})
+		if err != nil {
+			failures = append(failures, ImportFailure{row.Line, row.IP, err})
+			continue
+		}
+		inv.insert(router)
+		imported = append(imported, router)
+		lines[router.IP] = row.Line
+	}
+
+	// Géocodage des adresses (ou géocodage inverse des coordonnées sans adresse)
+	var rejected []string
+	failed := make(map[string]bool) // IP des routeurs rejetés
+	kept := imported[:0]
+	for _, router := range imported {
+		// Un routeur dont le parent a été rejeté est rejeté aussi, plutôt que rattaché à un autre parent
+		if failed[router.Parent] {
+			failures = append(failures, ImportFailure{lines[router.IP], router.IP, fmt.Errorf("parent %s rejeté (ligne %d)", router.Parent, lines[router.Parent])})
+			failed[router.IP] = true
+			rejected = append(rejected, router.IP)
+			continue
+		}
+
+		i := inv.find(router.IP)
+		if router.Adresse == "" && router.Visible {
+			inv.Routers[i].Adresse = inv.reverseAddress(router.Lat, router.Lon)
+			router = inv.Routers[i]
+		}
+		if router.Adresse == "" || router.Visible {
+			kept = append(kept, router)
+			continue
+		}
+
+		lat, lon, adresse, err := inv.locate(router.Adresse, router.IP, false)
+		if err != nil {
+			failures = append(failures, ImportFailure{lines[router.IP], router.IP, fmt.Errorf("géocodage de '%s': %w", router.Adresse, err)})
+			failed[router.IP] = true
+			rejected = append(rejected, router.IP)
+			continue
+		}
+		inv.Routers[i].Lat, inv.Routers[i].Lon, inv.Routers[i].Adresse, inv.Routers[i].Visible = lat, lon, adresse, true
+		kept = append(kept, inv.Routers[i])
+	}
+
+	// Retrait des routeurs rejetés, enfants d'abord (ils sont après leur parent dans le fichier)
+	for i := len(rejected) - 1; i >= 0; i-- {
+		inv.removeRouter(rejected[i])
+	}
+
+	slices.SortFunc(failures, func(a, b ImportFailure) int { return a.Line - b.Line })
+
+	return kept, failures
+}
+
+// Sous-commande import: importe des routeurs depuis un fichier CSV ou JSON.
+// Prend en entrée les options globales (*Options) et les arguments ([]string), renvoie une erreur.
+func cmdImport(opts *Options, args []string) error {
+
+	var format string
+	var rate float64
+	var dryRun, strict bool
+	set := newFlagSet("import", "fichier")
+	set.FlagLong(&format, "format", 0, "Format du fichier (csv, json). Défaut: déduit de l'extension.")
+	set.FlagLong(&rate, "rate", 0, "Nombre maximum d'appels par seconde à chaque service de géocodage. Défaut: limite du service (rate dans mikromap.json).")
+	set.FlagLong(&dryRun, "dry-run", 0, "Vérifier et géocoder les lignes sans écrire les fichiers.")
+	set.FlagLong(&strict, "strict", 0, "Ne rien importer si au moins une ligne est rejetée.")
+	positional, err := parseFlags(set, args, 1)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 || rate < 0 {
+		set.PrintUsage(os.Stderr)
+		return fmt.Errorf("%w: un fichier à importer (ou - pour l'entrée standard) et un --rate positif sont attendus", errUsage)
+	}
+	maxGeoRate = rate
+
+	// Lecture du fichier
+	path := positional[0]
+	var content []byte
+	if path == "-" {
+		content, err = io.ReadAll(os.Stdin)
+	} else {
+		content, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return fmt.Errorf("erreur lors de la lecture du fichier d'import: %w", err)
+	}
+
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	}
+	var rows []ImportRow
+	switch format {
+	case "csv":
+		rows, err = parseImportCSV(content)
+	case "json":
+		rows, err = parseImportJSON(content)
+	default:
+		return fmt.Errorf("%w: format d'import inconnu '%s' (attendu: csv, json)", errUsage, format)
+	}
+	if err != nil {
+		return err
+	}
+
+	inv := loadInventory()
+	imported, failures := inv.importRows(rows)
+
+	// Rapport
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if len(failures) > 0 {
+		fmt.Fprintln(w, "LIGNE\tIP\tERREUR")
+		for _, v := range failures {
+			fmt.Fprintf(w, "%d\t%s\t%v\n", v.Line, v.IP, v.Reason)
+		}
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintf(w, "%d routeur(s) valide(s), %d ligne(s) rejetée(s) sur %d.\n", len(imported), len(failures), len(rows))
+	w.Flush()
+
+	switch {
+	case dryRun:
+		fmt.Println("--dry-run: aucun fichier modifié.")
+	case strict && len(failures) > 0:
+		fmt.Println("--strict: aucun fichier modifié.")
+	case len(imported) > 0:
+		if err := inv.save(); err != nil {
+			return err
+		}
+		for _, v := range imported {
+			routerLogger(v).Info("routeur importé")
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("%w: %d ligne(s) rejetée(s)", errImport, len(failures))
+	}
+
+	return nil
+}
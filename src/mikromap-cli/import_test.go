@@ -0,0 +1,62 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestImportRowsRejectsChildren(t *testing.T) {
+
+	// En mode hors ligne, sans table statique: seules les adresses du cache sont géocodées
+	offline = true
+	t.Cleanup(func() { offline = false })
+
+	inv := &Inventory{
+		Routers:  []Router{{IP: "10.0.0.1", Type: typeMikrotik}},
+		Targets:  make(map[string][]PromTargets),
+		Profiles: defaultProfiles(),
+		Cache:    make(GeoCache),
+	}
+	inv.Cache.put("1 rue connue", GeoResult{Lat: 45, Lon: 4, Label: "1 Rue Connue", Source: "ban"})
+
+	rows := []ImportRow{
+		{Line: 1, IP: "10.0.0.2", Address: "1 rue connue", Parent: "10.0.0.1"},
+		{Line: 2, IP: "10.0.0.3", Address: "2 rue inconnue", Parent: "10.0.0.1"},
+		{Line: 3, IP: "10.0.0.4", Address: "1 rue connue", Parent: "10.0.0.3"},
+		{Line: 4, IP: "10.0.0.5", Address: "1 rue connue", Parent: "10.0.0.4"},
+		{Line: 5, IP: "10.0.0.6", Address: "1 rue connue", Parent: "10.0.0.2"},
+	}
+	imported, failures := inv.importRows(rows)
+
+	var got []string
+	for _, v := range imported {
+		got = append(got, v.IP)
+	}
+	if want := []string{"10.0.0.2", "10.0.0.6"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("routeurs importés = %v, attendu %v", got, want)
+	}
+
+	got = nil
+	for _, v := range failures {
+		got = append(got, v.IP)
+	}
+	if want := []string{"10.0.0.3", "10.0.0.4", "10.0.0.5"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("lignes rejetées = %v, attendu %v", got, want)
+	}
+
+	// Aucun routeur rejeté ne reste dans l'inventaire, ni rattaché à un autre parent
+	got = nil
+	for _, v := range inv.Routers {
+		got = append(got, v.IP+"<"+v.Parent)
+	}
+	if want := []string{"10.0.0.1<", "10.0.0.2<10.0.0.1", "10.0.0.6<10.0.0.2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("inventaire = %v, attendu %v", got, want)
+	}
+	for _, v := range inv.Targets["mikrotik_targets.json"] {
+		for _, target := range v.Targets {
+			if target == promTarget("10.0.0.3") || target == promTarget("10.0.0.4") || target == promTarget("10.0.0.5") {
+				t.Errorf("cible %s restée dans mikrotik_targets.json", target)
+			}
+		}
+	}
+}
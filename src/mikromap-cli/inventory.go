@@ -0,0 +1,752 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Types d'appareils connus sans profil dans mikromap.json.
+// Le préfixe "W" devant l'IP reste accepté comme alias du type watchguard.
+const (
+	typeMikrotik   = "mikrotik"
+	typeWatchguard = "watchguard"
+)
+
+// Fichiers modifiés par mikromap-cli: routers.json et les fichiers de cibles Prometheus de tous les profils d'appareils.
+// Ils sont lus et écrits ensemble pour rester cohérents entre eux.
+type Inventory struct {
+	Routers   []Router
+	Targets   map[string][]PromTargets // Nom du fichier de cibles -> contenu (nil si le fichier n'existe pas encore)
+	Profiles  map[string]DeviceProfile // Type d'appareil -> profil
+	Groups    map[string][]string      // Groupes de mikromap.json (nom -> utilisateurs Grafana membres)
+	Geocoding GeocodingConfig          // Configuration du géocodage de mikromap.json
+	Cache     GeoCache                 // Cache de géocodage (geocoding_cache.json)
+}
+
+// Saisie d'un nouveau routeur, depuis les options de la ligne de commande ou l'invite interactive.
+type RouterInput struct {
+	Target  string // Adresse IP ou nom DNS, éventuellement préfixée par "W" (Watchguard)
+	Address string // Adresse postale, le routeur n'est pas affiché sur la carte si vide
+	Users   string // Utilisateurs Grafana séparés par des virgules, @nom pour un groupe
+	Type    string // Type d'appareil, parmi les profils de mikromap.json (mikrotik par défaut)
+	Parent  string // IP du routeur parent (optionnel)
+
+	Lat *float64 // Coordonnées saisies à la main (optionnel, l'adresse n'est alors pas géocodée)
+	Lon *float64
+}
+
+// Modifications à appliquer à un routeur existant. Les champs nil sont laissés inchangés.
+type RouterEdit struct {
+	IP      *string
+	Address *string
+	Lat     *float64
+	Lon     *float64
+	Visible *bool
+	Users   *string
+	Type    *string
+	Parent  *string
+}
+
+// Lit routers.json et les fichiers de cibles Prometheus référencés par les profils d'appareils.
+// Ne prend rien en entrée et renvoie l'inventaire (*Inventory).
+// Les routeurs enregistrés avant l'ajout du champ type reçoivent mikrotik s'ils sont dans mikrotik_targets.json, watchguard sinon.
+func loadInventory() *Inventory {
+
+	config := readConfig()
+	inv := &Inventory{
+		Routers:   readJSON(),
+		Targets:   make(map[string][]PromTargets),
+		Profiles:  config.Devices,
+		Groups:    config.Groups,
+		Geocoding: config.Geocoding,
+		Cache:     readGeoCache(),
+	}
+
+	for _, name := range inv.targetFiles() {
+		if _, err := os.Stat(getPath(name)); errors.Is(err, os.ErrNotExist) {
+			inv.Targets[name] = nil
+			continue
+		}
+		inv.Targets[name] = readPromTargets(name)
+	}
+
+	for i, v := range inv.Routers {
+		if v.Type != "" {
+			continue
+		}
+		inv.Routers[i].Type = typeWatchguard
+		if hasTarget(inv.Targets["mikrotik_targets.json"], promTarget(v.IP)) {
+			inv.Routers[i].Type = typeMikrotik
+		}
+	}
+
+	return inv
+}
+
+// Renvoie les fichiers de cibles Prometheus référencés par les profils d'appareils.
+// Méthode de *Inventory. Ne prend rien en entrée et renvoie les noms des fichiers ([]string, triés).
+// mikrotik_targets.json est toujours lu, pour reprendre le type des routeurs enregistrés sans type.
+func (inv *Inventory) targetFiles() []string {
+
+	res := []string{"mikrotik_targets.json"}
+	for _, profile := range inv.Profiles {
+		for _, name := range profile.Targets {
+			if !slices.Contains(res, name) {
+				res = append(res, name)
+			}
+		}
+	}
+	slices.Sort(res)
+
+	return res
+}
+
+// Ecrit routers.json et les fichiers de cibles Prometheus en une seule transaction.
+// Méthode de *Inventory. Ne prend rien en entrée et renvoie une erreur si l'écriture a échoué (les fichiers sont alors laissés dans leur état d'origine).
+// Un fichier de cibles qui n'existait pas n'est créé que s'il contient au moins un appareil. Le cache de géocodage est écrit avec.
+func (inv *Inventory) save() error {
+
+	var files []confFile
+	for _, name := range inv.targetFiles() {
+		if inv.Targets[name] != nil {
+			files = append(files, confFile{name, inv.Targets[name]})
+		}
+	}
+
+	if len(inv.Cache) > 0 {
+		files = append(files, confFile{"geocoding_cache.json", inv.Cache})
+	}
+
+	// routers.json est remplacé en dernier: c'est le fichier surveillé par mikromap-api.
+	return writeFiles(append(files, confFile{"routers.json", inv.Routers}))
+}
+
+// Renommage des fichiers temporaires de writeFiles (remplacé par les tests pour simuler un échec).
+var rename = os.Rename
+
+// Verrou de conf/ partagé avec mikromap-api, pris pendant le remplacement des fichiers:
+// l'API le prend aussi entre sa vérification de routers.json et son écriture, pour ne jamais écraser une modification.
+const routersLock = ".routers.lock"
+
+// Prend le verrou de routers.json partagé avec mikromap-api.
+// Ne prend rien en entrée et renvoie la fonction qui le libère (func()) ou une erreur. Attend tant que l'API écrit le fichier.
+func lockRouters() (func(), error) {
+
+	// Ouvert en lecture seule: le fichier peut avoir été créé par l'API, qui tourne en sudo
+	file, err := os.OpenFile(getPath(routersLock), os.O_RDONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("erreur lors de l'ouverture du verrou %s: %w", getPath(routersLock), err)
+	}
+	err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("erreur lors du verrouillage de %s: %w", getPath(routersLock), err)
+	}
+
+	// La fermeture du fichier libère le verrou
+	return func() { file.Close() }, nil
+}
+
+// Fichier JSON de conf/ à écrire.
+type confFile struct {
+	name string
+	data any
+}
+
+// Ecrit plusieurs fichiers JSON de conf/ en tout ou rien.
+// Prend en entrée les fichiers à écrire ([]confFile), remplacés dans cet ordre, et renvoie une erreur.
+// Chaque fichier est d'abord écrit dans un fichier temporaire du même dossier, puis tous sont renommés.
+// Si un renommage échoue, les fichiers déjà remplacés sont restaurés avec leur contenu d'origine (ou supprimés s'ils n'existaient pas).
+func writeFiles(files []confFile) error {
+
+	type pending struct {
+		path     string
+		tmp      string
+		original []byte
+		existed  bool
+		mode     os.FileMode
+	}
+	var done []pending
+
+	// Ecriture des fichiers temporaires
+	var todo []pending
+	defer func() {
+		for _, v := range todo {
+			os.Remove(v.tmp)
+		}
+	}()
+	for _, f := range files {
+		name := f.name
+		p := pending{path: getPath(name), mode: 0644}
+
+		content, err := json.MarshalIndent(f.data, "", "    ")
+		if err != nil {
+			return fmt.Errorf("erreur lors de l'écriture de %s: %w", name, err)
+		}
+		content = append(content, '\n')
+
+		if info, err := os.Stat(p.path); err == nil {
+			p.mode = info.Mode().Perm()
+		}
+		p.original, err = os.ReadFile(p.path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("erreur lors de la lecture de %s: %w", name, err)
+		}
+		p.existed = err == nil
+
+		file, err := os.CreateTemp(filepath.Dir(p.path), "."+name+".*")
+		if err != nil {
+			return fmt.Errorf("erreur lors de l'ouverture de %s pour écriture: %w", name, err)
+		}
+		p.tmp = file.Name()
+		todo = append(todo, p)
+		_, err = file.Write(content)
+		if err == nil {
+			err = file.Chmod(p.mode)
+		}
+		if err == nil {
+			err = file.Close()
+		} else {
+			file.Close()
+		}
+		if err != nil {
+			return fmt.Errorf("erreur lors de l'écriture de %s: %w", name, err)
+		}
+	}
+
+	// Remplacement des fichiers, verrou pris
+	unlock, err := lockRouters()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	for _, p := range todo {
+		err := rename(p.tmp, p.path)
+		if err != nil {
+			for _, d := range done {
+				var rerr error
+				if d.existed {
+					rerr = os.WriteFile(d.path, d.original, d.mode)
+				} else {
+					rerr = os.Remove(d.path)
+				}
+				if rerr != nil {
+					logger.Error("impossible de restaurer le fichier", "file", d.path, "error", rerr)
+				}
+			}
+			return fmt.Errorf("erreur lors du remplacement de %s: %w", p.path, err)
+		}
+		done = append(done, p)
+	}
+
+	return nil
+}
+
+// Cherche un routeur dans l'inventaire.
+// Méthode de *Inventory. Prend en entrée l'IP (string, normalisée) et renvoie l'indice du routeur (int) ou -1 s'il est absent.
+func (inv *Inventory) find(ip string) int {
+
+	return slices.IndexFunc(inv.Routers, func(r Router) bool { return r.IP == ip })
+}
+
+// Cherche un routeur à partir de la saisie de l'utilisateur.
+// Méthode de *Inventory. Prend en entrée la saisie (string, préfixe "W" accepté), renvoie l'indice du routeur (int)
+// ou une erreur (errUsage si la saisie est invalide, errNotFound si le routeur est absent).
+func (inv *Inventory) lookup(input string) (int, error) {
+
+	target, _ := splitWatchguard(strings.TrimSpace(input))
+	target, err := normalizeTarget(target)
+	if err != nil {
+		return -1, fmt.Errorf("%w: %v", errUsage, err)
+	}
+
+	i := inv.find(target)
+	if i < 0 {
+		return -1, fmt.Errorf("%w: %s", errNotFound, target)
+	}
+
+	return i, nil
+}
+
+// Renvoie les jobs Prometheus dans lesquels un routeur est déclaré.
+// Méthode de *Inventory. Prend en entrée l'IP (string) et renvoie les noms des jobs ([]string).
+func (inv *Inventory) jobs(ip string) []string {
+
+	var res []string
+	for _, name := range inv.targetFiles() {
+		for _, v := range inv.Targets[name] {
+			if slices.Contains(v.Targets, promTarget(ip)) {
+				res = append(res, v.Labels.Job)
+			}
+		}
+	}
+
+	return res
+}
+
+// Déclare un routeur dans les fichiers de cibles Prometheus du profil de son type, et le retire des autres.
+// Méthode de *Inventory. Prend en entrée le routeur (Router) et ne renvoie rien.
+func (inv *Inventory) setTargets(router Router) {
+
+	profile := inv.Profiles[router.Type]
+	for _, name := range inv.targetFiles() {
+		if !slices.Contains(profile.Targets, name) {
+			inv.Targets[name] = removeTarget(inv.Targets[name], promTarget(router.IP))
+			continue
+		}
+		if len(inv.Targets[name]) == 0 {
+			inv.Targets[name] = []PromTargets{{Labels: Labels{Job: strings.TrimSuffix(name, "_targets.json")}, Targets: []string{}}}
+		}
+		inv.Targets[name] = addTarget(inv.Targets[name], promTarget(router.IP))
+	}
+}
+
+// Retire un routeur de tous les fichiers de cibles Prometheus.
+// Méthode de *Inventory. Prend en entrée l'IP (string) et ne renvoie rien.
+func (inv *Inventory) removeTargets(ip string) {
+
+	for name, data := range inv.Targets {
+		inv.Targets[name] = removeTarget(data, promTarget(ip))
+	}
+}
+
+// Renvoie les types d'appareils définis dans la configuration.
+// Prend en entrée les profils d'appareils (map type -> DeviceProfile, voir Config.Devices) et renvoie les types ([]string, triés).
+func deviceTypes(profiles map[string]DeviceProfile) []string {
+
+	var res []string
+	for name := range profiles {
+		res = append(res, name)
+	}
+	slices.Sort(res)
+
+	return res
+}
+
+// Renvoie les types d'appareils listés dans l'aide des options --type.
+// Ne prend rien en entrée et renvoie le texte (string). Seuls les types par défaut sont nommés: l'aide ne lit pas mikromap.json,
+// pour rester disponible même si le fichier est invalide (checkType liste tous les types configurés en cas d'erreur).
+func typeHelp() string {
+
+	return strings.Join(deviceTypes(defaultProfiles()), ", ") + ", ou un type déclaré dans devices de mikromap.json"
+}
+
+// Vérifie le type d'appareil saisi.
+// Prend en entrée le type (string) et les profils d'appareils (map type -> DeviceProfile),
+// renvoie sa forme normalisée (string) ou une erreur (errUsage) s'il n'a pas de profil.
+func checkType(deviceType string, profiles map[string]DeviceProfile) (string, error) {
+
+	deviceType = strings.ToLower(strings.TrimSpace(deviceType))
+	if _, ok := profiles[deviceType]; !ok {
+		return "", fmt.Errorf("%w: type d'appareil inconnu '%s' (attendu: %s)", errUsage, deviceType, strings.Join(deviceTypes(profiles), ", "))
+	}
+
+	return deviceType, nil
+}
+
+// Vérifie le routeur parent saisi.
+// Méthode de *Inventory. Prend en entrée la saisie (string, vide si aucun parent) et l'IP du routeur concerné (string),
+// renvoie l'IP normalisée du parent (string) ou une erreur si le parent est invalide ou absent de routers.json.
+func (inv *Inventory) checkParent(input string, ip string) (string, error) {
+
+	input, _ = splitWatchguard(strings.TrimSpace(input))
+	if input == "" {
+		return "", nil
+	}
+
+	parent, err := normalizeTarget(input)
+	if err != nil {
+		return "", fmt.Errorf("%w: routeur parent invalide: %v", errUsage, err)
+	}
+	if parent == ip {
+		return "", fmt.Errorf("%w: un routeur ne peut pas être son propre parent", errUsage)
+	}
+	if inv.find(parent) < 0 {
+		return "", fmt.Errorf("%w: routeur parent %s", errNotFound, parent)
+	}
+
+	// Le parent ne doit pas être un descendant du routeur (boucle dans la topologie)
+	for p, n := parent, 0; p != "" && n <= len(inv.Routers); n++ {
+		if p == ip {
+			return "", fmt.Errorf("%w: %s est un descendant de %s", errUsage, parent, ip)
+		}
+		j := inv.find(p)
+		if j < 0 {
+			break
+		}
+		p = inv.Routers[j].Parent
+	}
+
+	return parent, nil
+}
+
+// Géocode une adresse postale (voir geocode) et décale les coordonnées si d'autres routeurs sont déjà à cette adresse.
+// Méthode de *Inventory. Prend en entrée l'adresse (string), l'IP du routeur concerné (string, ignoré dans le décompte)
+// et si l'utilisateur peut choisir parmi les résultats (bool, voir geocodeAddress),
+// renvoie latitude (float64), longitude (float64), adresse trouvée (string) ou une erreur.
+func (inv *Inventory) locate(addr string, ip string, choose bool) (float64, float64, string, error) {
+
+	res, err := inv.geocode(addr, choose)
+	if err != nil {
+		return 0, 0, "", err
+	}
+	lat, lon, adresse := res.Lat, res.Lon, res.Label
+
+	// A chaque routeur avec la même adresse, on le décale légèrement pour éviter une superposition.
+	for _, v := range inv.Routers {
+		if v.Adresse == adresse && v.IP != ip {
+			lat += 0.0001
+		}
+	}
+
+	return lat, lon, adresse, nil
+}
+
+// Cherche l'adresse postale la plus proche de coordonnées saisies à la main (géocodage inverse).
+// Méthode de *Inventory. Prend en entrée latitude (float64) et longitude (float64), renvoie l'adresse (string).
+// En cas d'échec (ou en mode hors ligne sans table statique), un avertissement est affiché et l'adresse est vide:
+// le routeur reste affiché sur la carte, sans adresse.
+func (inv *Inventory) reverseAddress(lat float64, lon float64) string {
+
+	geocoder, _, err := loadGeocoder(inv.Geocoding)
+	if err == nil {
+		var res GeoResult
+		res, err = geocoder.Reverse(lat, lon)
+		if err == nil {
+			return res.Label
+		}
+	}
+	logger.Warn("aucune adresse trouvée pour ces coordonnées", "lat", lat, "lon", lon, "error", err)
+
+	return ""
+}
+
+// Lit des coordonnées saisies sous la forme "lat, lon".
+// Prend en entrée la saisie (string) et renvoie latitude (float64), longitude (float64) ou une erreur (errUsage) si la saisie est invalide ou hors limites.
+// Le séparateur est une virgule, ou un point-virgule si les décimales sont séparées par des virgules (ex: "45,43; 4,39").
+func parseCoords(input string) (float64, float64, error) {
+
+	sep := ","
+	if strings.Contains(input, ";") {
+		sep = ";"
+	}
+	parts := strings.Split(input, sep)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("%w: coordonnées invalides '%s' (attendu: lat, lon)", errUsage, input)
+	}
+
+	var coords [2]float64
+	for i, v := range parts {
+		f, err := strconv.ParseFloat(strings.Replace(strings.TrimSpace(v), ",", ".", 1), 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("%w: coordonnées invalides '%s' (attendu: lat, lon)", errUsage, input)
+		}
+		coords[i] = f
+	}
+	if err := checkCoords(coords[0], coords[1]); err != nil {
+		return 0, 0, err
+	}
+
+	return coords[0], coords[1], nil
+}
+
+// Vérifie des coordonnées saisies à la main.
+// Prend en entrée latitude (float64) et longitude (float64), renvoie une erreur (errUsage) si elles sont hors limites.
+func checkCoords(lat float64, lon float64) error {
+
+	if lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		return fmt.Errorf("%w: coordonnées hors limites (%f, %f)", errUsage, lat, lon)
+	}
+
+	return nil
+}
+
+// Vérifie la saisie d'un nouveau routeur sans le géocoder ni l'ajouter.
+// Méthode de *Inventory. Prend en entrée la saisie (RouterInput) et renvoie le routeur (Router, avec son type et ses coordonnées si elles ont été saisies)
+// ou une erreur (errUsage si la saisie est invalide, errExists si le routeur existe déjà).
+func (inv *Inventory) prepareRouter(input RouterInput) (Router, error) {
+
+	// Vérification et supression préfixe "W" pour Watchguard
+	target, isWatchguard := splitWatchguard(strings.TrimSpace(input.Target))
+	deviceType := input.Type
+	switch {
+	case deviceType != "":
+	case isWatchguard:
+		deviceType = typeWatchguard
+	default:
+		deviceType = typeMikrotik
+	}
+	deviceType, err := checkType(deviceType, inv.Profiles)
+	if err != nil {
+		return Router{}, err
+	}
+
+	// Validation de la cible (IPv4, IPv6 ou nom DNS)
+	addrIP, err := normalizeTarget(target)
+	if err != nil {
+		return Router{}, fmt.Errorf("%w: %v", errUsage, err)
+	}
+	if inv.find(addrIP) >= 0 {
+		return Router{}, fmt.Errorf("%w: %s", errExists, addrIP)
+	}
+	resolved, err := net.LookupHost(addrIP)
+	if err != nil {
+		return Router{}, fmt.Errorf("impossible de résoudre %s: %w", addrIP, err)
+	}
+	if net.ParseIP(addrIP) == nil {
+		logger.Debug("nom DNS résolu", "ip", addrIP, "resolved", strings.Join(resolved, ", "))
+	}
+
+	newRouter := Router{IP: addrIP, Type: deviceType, Adresse: strings.TrimSpace(input.Address)}
+
+	// Coordonnées saisies à la main: l'adresse n'est pas géocodée
+	if (input.Lat == nil) != (input.Lon == nil) {
+		return Router{}, fmt.Errorf("%w: la latitude et la longitude doivent être renseignées ensemble", errUsage)
+	}
+	if input.Lat != nil {
+		if err := checkCoords(*input.Lat, *input.Lon); err != nil {
+			return Router{}, err
+		}
+		newRouter.Lat, newRouter.Lon, newRouter.Visible, newRouter.Manual = *input.Lat, *input.Lon, true, true
+	}
+
+	newRouter.Username, newRouter.Users, newRouter.Groups, err = parseUsers(input.Users, inv.Groups)
+	if err != nil {
+		return Router{}, err
+	}
+
+	newRouter.Parent, err = inv.checkParent(input.Parent, addrIP)
+	if err != nil {
+		return Router{}, err
+	}
+
+	return newRouter, nil
+}
+
+// Ajoute un routeur déjà vérifié à l'inventaire et aux jobs Prometheus correspondant à son type.
+// Méthode de *Inventory. Prend en entrée le routeur (Router) et ne renvoie rien.
+func (inv *Inventory) insert(router Router) {
+
+	inv.Routers = append(inv.Routers, router)
+	inv.setTargets(router)
+}
+
+// Ajoute un routeur à l'inventaire (sans écrire les fichiers).
+// Méthode de *Inventory. Prend en entrée la saisie (RouterInput) et renvoie le routeur ajouté (Router)
+// ou une erreur (errUsage si la saisie est invalide, errExists si le routeur existe déjà).
+func (inv *Inventory) addRouter(input RouterInput) (Router, error) {
+
+	newRouter, err := inv.prepareRouter(input)
+	if err != nil {
+		return Router{}, err
+	}
+
+	// Récupération coordonnées géographiques, ou de l'adresse si seules les coordonnées ont été saisies
+	switch {
+	case newRouter.Adresse != "" && input.Lat == nil:
+		newRouter.Lat, newRouter.Lon, newRouter.Adresse, err = inv.locate(newRouter.Adresse, newRouter.IP, interactive())
+		if err != nil {
+			return Router{}, err
+		}
+		newRouter.Visible = true
+		fmt.Printf("- %s\n- %f, %f\n", newRouter.Adresse, newRouter.Lat, newRouter.Lon)
+	case newRouter.Adresse == "" && input.Lat != nil:
+		newRouter.Adresse = inv.reverseAddress(newRouter.Lat, newRouter.Lon)
+		if newRouter.Adresse != "" {
+			fmt.Printf("- %s\n- %f, %f\n", newRouter.Adresse, newRouter.Lat, newRouter.Lon)
+		}
+	}
+
+	inv.insert(newRouter)
+
+	return newRouter, nil
+}
+
+// Retire un routeur de l'inventaire (sans écrire les fichiers).
+// Méthode de *Inventory. Prend en entrée la saisie (string) et renvoie le routeur retiré (Router) ou une erreur (errNotFound s'il est absent).
+// Les enfants du routeur retiré sont rattachés à son propre parent pour ne pas casser la topologie.
+func (inv *Inventory) removeRouter(input string) (Router, error) {
+
+	i, err := inv.lookup(input)
+	if err != nil {
+		return Router{}, err
+	}
+	removed := inv.Routers[i]
+	inv.Routers = slices.Delete(inv.Routers, i, i+1)
+
+	for i, v := range inv.Routers {
+		if v.Parent == removed.IP {
+			inv.Routers[i].Parent = removed.Parent
+			routerLogger(v).Info("routeur rattaché au parent du routeur supprimé", "parent", removed.Parent)
+		}
+	}
+
+	inv.removeTargets(removed.IP)
+
+	return removed, nil
+}
+
+// Modifie un routeur de l'inventaire (sans écrire les fichiers).
+// Méthode de *Inventory. Prend en entrée la saisie de l'IP (string) et les modifications (RouterEdit),
+// renvoie le routeur modifié (Router) ou une erreur.
+// Une nouvelle adresse est géocodée (sauf si des coordonnées sont aussi saisies), une adresse vide masque le routeur sur la carte.
+// Des coordonnées saisies pour un routeur sans adresse (ou avec une adresse vide) sont complétées par géocodage inverse.
+// Un changement d'IP est répercuté dans les fichiers de cibles Prometheus et sur les routeurs enfants.
+func (inv *Inventory) editRouter(input string, edit RouterEdit) (Router, error) {
+
+	i, err := inv.lookup(input)
+	if err != nil {
+		return Router{}, err
+	}
+	router := inv.Routers[i]
+	oldIP := router.IP
+
+	if edit.Type != nil {
+		router.Type, err = checkType(*edit.Type, inv.Profiles)
+		if err != nil {
+			return Router{}, err
+		}
+	}
+
+	if edit.IP != nil {
+		target, _ := splitWatchguard(strings.TrimSpace(*edit.IP))
+		newIP, err := normalizeTarget(target)
+		if err != nil {
+			return Router{}, fmt.Errorf("%w: %v", errUsage, err)
+		}
+		if newIP != oldIP {
+			if inv.find(newIP) >= 0 {
+				return Router{}, fmt.Errorf("%w: %s", errExists, newIP)
+			}
+			if _, err := net.LookupHost(newIP); err != nil {
+				return Router{}, fmt.Errorf("impossible de résoudre %s: %w", newIP, err)
+			}
+			router.IP = newIP
+		}
+	}
+
+	// Coordonnées saisies à la main ou géocodage de la nouvelle adresse
+	if (edit.Lat == nil) != (edit.Lon == nil) {
+		return Router{}, fmt.Errorf("%w: la latitude et la longitude doivent être renseignées ensemble", errUsage)
+	}
+	switch {
+	case edit.Lat != nil:
+		if err := checkCoords(*edit.Lat, *edit.Lon); err != nil {
+			return Router{}, err
+		}
+		router.Lat, router.Lon, router.Visible, router.Manual = *edit.Lat, *edit.Lon, true, true
+		if edit.Address != nil {
+			router.Adresse = strings.TrimSpace(*edit.Address)
+		}
+		if router.Adresse == "" {
+			router.Adresse = inv.reverseAddress(router.Lat, router.Lon)
+		}
+	case edit.Address != nil:
+		router.Lat, router.Lon, router.Adresse, router.Visible, router.Manual = 0, 0, "", false, false
+		if addr := strings.TrimSpace(*edit.Address); addr != "" {
+			router.Lat, router.Lon, router.Adresse, err = inv.locate(addr, oldIP, interactive())
+			if err != nil {
+				return Router{}, err
+			}
+			router.Visible = true
+		}
+	}
+
+	if edit.Visible != nil {
+		if *edit.Visible && router.Adresse == "" && router.Lat == 0 && router.Lon == 0 {
+			return Router{}, fmt.Errorf("%w: le routeur n'a ni adresse ni coordonnées, il ne peut pas être affiché sur la carte", errUsage)
+		}
+		router.Visible = *edit.Visible
+	}
+
+	if edit.Users != nil {
+		router.Username, router.Users, router.Groups, err = parseUsers(*edit.Users, inv.Groups)
+		if err != nil {
+			return Router{}, err
+		}
+	}
+
+	if edit.Parent != nil {
+		router.Parent, err = inv.checkParent(*edit.Parent, oldIP)
+		if err != nil {
+			return Router{}, err
+		}
+	}
+
+	// Application des modifications
+	inv.Routers[i] = router
+	if router.IP != oldIP {
+		for j, v := range inv.Routers {
+			if v.Parent == oldIP {
+				inv.Routers[j].Parent = router.IP
+			}
+		}
+		inv.removeTargets(oldIP)
+	}
+	inv.setTargets(router)
+
+	return router, nil
+}
+
+// Renvoie les utilisateurs et groupes d'un routeur tels qu'ils sont saisis (groupes préfixés par @).
+// Prend en entrée le routeur (Router) et renvoie la liste ([]string).
+func routerUsers(router Router) []string {
+
+	var res []string
+	if router.Username != "" {
+		res = append(res, router.Username)
+	}
+	res = append(res, router.Users...)
+	for _, g := range router.Groups {
+		res = append(res, "@"+g)
+	}
+
+	return res
+}
+
+// Indique si une cible est présente dans un fichier de cibles Prometheus.
+// Prend en entrée les données ([]PromTargets) et la cible (string), renvoie un booléen.
+func hasTarget(data []PromTargets, target string) bool {
+
+	for _, v := range data {
+		if slices.Contains(v.Targets, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Ajoute une cible au premier job d'un fichier de cibles Prometheus, si elle n'y est pas déjà.
+// Prend en entrée les données ([]PromTargets) et la cible (string), renvoie les données modifiées ([]PromTargets).
+func addTarget(data []PromTargets, target string) []PromTargets {
+
+	if hasTarget(data, target) {
+		return data
+	}
+	if len(data) == 0 {
+		return []PromTargets{{Targets: []string{target}}}
+	}
+	data[0].Targets = append(data[0].Targets, target)
+
+	return data
+}
+
+// Retire une cible de tous les jobs d'un fichier de cibles Prometheus.
+// Prend en entrée les données ([]PromTargets) et la cible (string), renvoie les données modifiées ([]PromTargets).
+func removeTarget(data []PromTargets, target string) []PromTargets {
+
+	for i := range data {
+		data[i].Targets = slices.DeleteFunc(data[i].Targets, func(v string) bool { return v == target })
+	}
+
+	return data
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteFiles(t *testing.T) {
+
+	errRename := errors.New("renommage impossible")
+
+	tests := []struct {
+		name   string
+		failOn string // Fichier dont le renommage échoue (vide: aucun)
+		want   map[string]string
+	}{
+		{"succès", "", map[string]string{"a.json": "[\n    \"nouveau\"\n]\n", "b.json": "[\n    \"nouveau\"\n]\n", "c.json": "[\n    \"nouveau\"\n]\n"}},
+		{"échec du premier", "a.json", map[string]string{"a.json": "ancien a", "b.json": "ancien b"}},
+		{"échec du fichier créé", "c.json", map[string]string{"a.json": "ancien a", "b.json": "ancien b"}},
+		{"échec du dernier", "b.json", map[string]string{"a.json": "ancien a", "b.json": "ancien b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("HOME", t.TempDir())
+			dir := filepath.Dir(getPath("routers.json"))
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				t.Fatal(err)
+			}
+			// a.json et b.json existent, c.json est créé
+			os.WriteFile(getPath("a.json"), []byte("ancien a"), 0600)
+			os.WriteFile(getPath("b.json"), []byte("ancien b"), 0644)
+
+			rename = func(oldpath, newpath string) error {
+				if filepath.Base(newpath) == tt.failOn {
+					return errRename
+				}
+				return os.Rename(oldpath, newpath)
+			}
+			t.Cleanup(func() { rename = os.Rename })
+
+			err := writeFiles([]confFile{{"a.json", []string{"nouveau"}}, {"c.json", []string{"nouveau"}}, {"b.json", []string{"nouveau"}}})
+			if tt.failOn == "" && err != nil || tt.failOn != "" && !errors.Is(err, errRename) {
+				t.Fatalf("erreur = %v", err)
+			}
+
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, v := range entries {
+				if v.Name() == routersLock {
+					continue
+				}
+				if strings.HasPrefix(v.Name(), ".") {
+					t.Errorf("fichier temporaire %s laissé dans conf/", v.Name())
+				}
+				if _, ok := tt.want[v.Name()]; !ok {
+					t.Errorf("fichier %s inattendu", v.Name())
+				}
+			}
+			for name, want := range tt.want {
+				got, err := os.ReadFile(getPath(name))
+				if err != nil {
+					t.Errorf("%s: %v", name, err)
+					continue
+				}
+				if string(got) != want {
+					t.Errorf("%s = %q, attendu %q", name, got, want)
+				}
+			}
+
+			// Les droits d'origine sont conservés
+			if info, err := os.Stat(getPath("a.json")); err == nil && info.Mode().Perm() != 0600 {
+				t.Errorf("droits de a.json = %v, attendu 0600", info.Mode().Perm())
+			}
+		})
+	}
+}
+
+func TestWriteFilesWaitsForLock(t *testing.T) {
+
+	t.Setenv("HOME", t.TempDir())
+	if err := os.MkdirAll(filepath.Dir(getPath("routers.json")), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// mikromap-api vérifie puis écrit routers.json
+	unlock, err := lockRouters()
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() {
+		done <- writeFiles([]confFile{{"routers.json", []Router{}}})
+	}()
+	select {
+	case <-done:
+		unlock()
+		t.Fatal("writeFiles n'a pas attendu le verrou")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if _, err := os.Stat(getPath("routers.json")); !errors.Is(err, os.ErrNotExist) {
+		t.Error("routers.json remplacé verrou pris")
+	}
+	unlock()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(getPath("routers.json")); err != nil {
+		t.Errorf("routers.json non écrit: %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Colonnes affichées par list selon le format de sortie.
+var listColumns = map[string][]string{
+	"table": {"ip", "user", "address", "coords", "jobs"},
+	"wide":  {"ip", "type", "user", "address", "coords", "visible", "parent", "jobs", "statut", "rtt", "version"},
+}
+
+// Colonnes utilisables pour le tri.
+var sortColumns = []string{"ip", "type", "user", "username", "address", "lat", "lon", "visible", "parent", "jobs", "statut", "rtt", "version"}
+
+// Compare deux lignes d'inventaire selon une colonne.
+// Prend en entrée les deux lignes (RouterRecord) et la colonne (string), renvoie -1, 0 ou 1.
+// Les IP sont comparées numériquement (les noms DNS après les IP), les coordonnées et le RTT comme des nombres, le reste sans tenir compte de la casse.
+func compareRecords(a RouterRecord, b RouterRecord, column string) int {
+
+	switch column {
+	case "ip":
+		ipA, errA := netip.ParseAddr(a.IP)
+		ipB, errB := netip.ParseAddr(b.IP)
+		switch {
+		case errA == nil && errB == nil:
+			return ipA.Compare(ipB)
+		case errA == nil:
+			return -1
+		case errB == nil:
+			return 1
+		}
+	case "lat", "lon", "rtt":
+		x, _ := strconv.ParseFloat(a.values([]string{column})[0], 64)
+		y, _ := strconv.ParseFloat(b.values([]string{column})[0], 64)
+		return cmp.Compare(x, y)
+	}
+
+	return cmp.Compare(strings.ToLower(a.values([]string{column})[0]), strings.ToLower(b.values([]string{column})[0]))
+}
+
+// Sous-commande list: affiche et recherche les routeurs de l'inventaire.
+// Prend en entrée les options globales (*Options) et les arguments ([]string), renvoie une erreur.
+func cmdList(opts *Options, args []string) error {
+
+	var output string = "table"
+	var sortBy string = "ip"
+	set := newFlagSet("list", "")
+	set.FlagLong(&output, "output", 'o', "Format de sortie (table, wide, json).\nDéfaut:")
+	set.FlagLong(&sortBy, "sort", 0, "Colonne de tri ("+strings.Join(sortColumns, ", ")+"), préfixée par - pour un tri décroissant.\nDéfaut:")
+	filter := addFilterFlags(set)
+	set.FlagLong(&filter.Statut, "status", 0, "Routeurs ayant ce statut (up, down, injoignable), récupéré auprès de mikromap-api.")
+	set.FlagLong(&opts.APIURL, "api", 0, "URL de mikromap-api.\nDéfaut:")
+	set.FlagLong(&opts.APIToken, "api-token", 0, "Jeton d'accès à mikromap-api.")
+	if _, err := parseFlags(set, args, 0); err != nil {
+		return err
+	}
+	inv := loadInventory()
+	if err := filter.check(inv.Profiles); err != nil {
+		return err
+	}
+	if output != "json" && listColumns[output] == nil {
+		return fmt.Errorf("%w: format de sortie inconnu '%s' (attendu: table, wide, json)", errUsage, output)
+	}
+	column, descending := strings.CutPrefix(sortBy, "-")
+	if !slices.Contains(sortColumns, column) {
+		return fmt.Errorf("%w: colonne de tri inconnue '%s' (attendu: %s)", errUsage, column, strings.Join(sortColumns, ", "))
+	}
+
+	// Statut en direct: obligatoire pour filtrer, affiché si l'API est joignable pour les sorties wide et json
+	var status map[string]Router
+	if filter.Statut != "" || output != "table" || column == "statut" || column == "rtt" || column == "version" {
+		var err error
+		status, err = fetchStatus(opts)
+		if err != nil && filter.Statut != "" {
+			return err
+		}
+		if err != nil {
+			logger.Warn("statut des routeurs indisponible", "error", err)
+		}
+	}
+
+	records := inv.records(*filter, status)
+	slices.SortStableFunc(records, func(a, b RouterRecord) int {
+		if descending {
+			return compareRecords(b, a, column)
+		}
+		return compareRecords(a, b, column)
+	})
+
+	if output == "json" {
+		if records == nil {
+			records = []RouterRecord{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "    ")
+		return enc.Encode(records)
+	}
+
+	columns := listColumns[output]
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.ToUpper(strings.Join(columns, "\t")))
+	for _, v := range records {
+		fmt.Fprintln(w, strings.Join(v.values(columns), "\t"))
+	}
+
+	return w.Flush()
+}
@@ -5,8 +5,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"io"
-	"log"
+	"net"
 	"net/http"
 	"os"
 	"strings"
@@ -17,14 +16,23 @@ import (
 
 // Structure routers.json
 type Router struct {
-	IP       string  `json:"ip"`
-	Lat      float64 `json:"lat"`
-	Lon      float64 `json:"lon"`
-	Adresse  string  `json:"adresse"`
-	Username string  `json:"username"`
-	Statut   int     `json:"statut"`
-	RTT      float64 `json:"rtt"`
-	Visible  bool    `json:"visible"`
+	IP       string   `json:"ip"`
+	Type     string   `json:"type,omitempty"` // Type d'appareil, profil défini dans mikromap.json (voir DeviceProfile)
+	Lat      float64  `json:"lat"`
+	Lon      float64  `json:"lon"`
+	Adresse  string   `json:"adresse"`
+	Username string   `json:"username"`
+	Statut   int      `json:"statut"`
+	RTT      float64  `json:"rtt"`
+	Visible  bool     `json:"visible"`
+	Users    []string `json:"users,omitempty"`  // Utilisateurs Grafana supplémentaires ayant accès au routeur
+	Groups   []string `json:"groups,omitempty"` // Groupes (définis dans mikromap.json) ayant accès au routeur
+	Resolu   string   `json:"resolu,omitempty"` // Renseigné par mikromap-api
+	Parent   string   `json:"parent,omitempty"` // IP du routeur à travers lequel celui-ci est joignable (optionnel)
+	Manual   bool     `json:"manual,omitempty"` // Coordonnées saisies à la main, non modifiées par regeocode
+	Cause    string   `json:"cause,omitempty"`  // Renseigné par mikromap-api
+
+	RouterOS json.RawMessage `json:"routeros,omitempty"` // Renseigné par mikromap-api, conservé tel quel
 }
 
 // Structure global_targets.json et mikrotik_targets.json
@@ -45,70 +53,6 @@ type User struct {
 	OrgId    int    `json:"OrgId"`
 }
 
-// Fait un appel à l'API renseignée.
-// Prend en entrée une adresse (string), renvoie le code de statut (int) et le corps ([]byte) de la réponse.
-// L'API Adresse du gouvernement est gratuite et fonctionne parfaitement pour la France (50 calls/IP/sec).
-// Si besoin d'utiliser une autre API, penser à changer la partie formatage et la fonction extractCoords.
-func geoAPI(addr string) ([]byte, int) {
-
-	// Formatage de la requête
-	var addrConcat string = strings.ReplaceAll(addr, " ", "+")
-	var reqURL string = fmt.Sprintf("https://api-adresse.data.gouv.fr/search/?q=%s&limit=1", addrConcat) // Modifier en fonction de l'API à utiliser
-
-	// Exécution de la requête
-	res, err := http.Get(reqURL)
-	if err != nil {
-		log.Fatalf("--- Erreur lors de l'appel à l'API de géocodage:\n%s", err)
-	}
-
-	// Traitement de la réponse
-	resData, err := io.ReadAll(res.Body)
-	if err != nil {
-		log.Fatalf("--- Erreur lors du traitement de la réponse de l'API de géocodage:\n%s", err)
-	}
-
-	return resData, res.StatusCode
-}
-
-// Traite le JSON reçu et en extrait les coordonnées de l'adresse.
-// Prend en entrée des données JSON ([]byte) et renvoie latitude (float64), longitude (float64) et adresse (string).
-// Doit être adaptée selon l'API.
-func extractCoords(data []byte) (float64, float64, string) {
-
-	var lat, lon float64
-	var adresse string
-
-	// Structure de la réponse JSON.
-	// Doit être adaptée selon l'API. On peut omettre les champs inutiles.
-	// Des outils existent pour le générer automatiquement (ex: https://mholt.github.io/json-to-go/)
-	type Geometry struct {
-		Coordinates []float64 `json:"coordinates"`
-	}
-	type Properties struct {
-		Label string `json:"label"`
-	}
-	type Features struct {
-		Geometry   Geometry   `json:"geometry"`
-		Properties Properties `json:"properties"`
-	}
-	type Data struct {
-		Features []Features `json:"features"`
-	}
-
-	var target Data
-
-	// Traitement des données JSON
-	err := json.Unmarshal(data, &target)
-	if err != nil {
-		log.Fatalf("--- Erreur lors du traitement des données JSON reçues:\n%s", err)
-	}
-
-	// Récupération des coordonnées
-	lat, lon, adresse = target.Features[0].Geometry.Coordinates[1], target.Features[0].Geometry.Coordinates[0], target.Features[0].Properties.Label
-
-	return lat, lon, adresse
-}
-
 // Renvoie le chemin vers le fichier JSON spécifié.
 // Prend le nom du fichier en entrée et renvoie le chemin (string).
 // A modifier si besoin de mettre le fichier ailleurs.
@@ -127,37 +71,18 @@ func readJSON() []Router {
 	// Lecture du fichier
 	content, err := os.ReadFile(getPath("routers.json"))
 	if err != nil {
-		log.Fatalf("--- Erreur lors de la lecture du fichier JSON:\n%s", err)
+		fatal("erreur lors de la lecture du fichier JSON", "file", getPath("routers.json"), "error", err)
 	}
 
 	// Traitement des données
 	err = json.NewDecoder(bytes.NewBuffer(content)).Decode(&data)
 	if err != nil {
-		log.Fatalf("--- Erreur lors du traitement des données du fichier JSON:\n%s", err)
+		fatal("erreur lors du traitement des données du fichier JSON", "file", getPath("routers.json"), "error", err)
 	}
 
 	return data
 }
 
-// Ecrit par-dessus le fichier JSON.
-// Prend en entrée les données à écrire ([]Router) et ne renvoie rien.
-func writeJSON(data []Router) {
-
-	// Ouverture du fichier
-	content, err := os.OpenFile(getPath("routers.json"), os.O_WRONLY|os.O_TRUNC, os.ModePerm)
-	if err != nil {
-		log.Fatalf("--- Erreur lors de l'ouverture du fichier JSON pour écriture:\n%s", err)
-	}
-
-	// Ecriture du fichier
-	enc := json.NewEncoder(content)
-	enc.SetIndent("", "    ")
-	err = enc.Encode(data)
-	if err != nil {
-		log.Fatalf("--- Erreur lors de l'écriture du fichier JSON:\n%s", err)
-	}
-}
-
 // Récupère les données du fichier des cibles Prometheus JSON.
 // Prend le fichier à lire en entrée et renvoie les données dans un slice de struct []PromTargets.
 func readPromTargets(target string) []PromTargets {
@@ -167,37 +92,18 @@ func readPromTargets(target string) []PromTargets {
 	// Lecture du fichier
 	content, err := os.ReadFile(getPath(target))
 	if err != nil {
-		log.Fatalf("--- Erreur lors de la lecture du fichier JSON:\n%s", err)
+		fatal("erreur lors de la lecture du fichier JSON", "file", getPath(target), "error", err)
 	}
 
 	// Traitement des données
 	err = json.NewDecoder(bytes.NewBuffer(content)).Decode(&data)
 	if err != nil {
-		log.Fatalf("--- Erreur lors du traitement des données du fichier JSON:\n%s", err)
+		fatal("erreur lors du traitement des données du fichier JSON", "file", getPath(target), "error", err)
 	}
 
 	return data
 }
 
-// Ecrit par-dessus le fichier de cibles Prometheus JSON.
-// Prend en entrée les données à écrire ([]PromTargets) et le nom du fichier de conf (string) et ne renvoie rien.
-func writePromTargets(data []PromTargets, target string) {
-
-	// Ouverture du fichier
-	content, err := os.OpenFile(getPath(target), os.O_WRONLY|os.O_TRUNC, os.ModePerm)
-	if err != nil {
-		log.Fatalf("--- Erreur lors de l'ouverture du fichier JSON pour écriture:\n%s", err)
-	}
-
-	// Ecriture du fichier
-	enc := json.NewEncoder(content)
-	enc.SetIndent("", "    ")
-	err = enc.Encode(data)
-	if err != nil {
-		log.Fatalf("--- Erreur lors de l'écriture du fichier JSON:\n%s", err)
-	}
-}
-
 // Crée un novueau fichier et y écrit la paire login:password d'un utilisateur.
 // Méthode de User. Ne prend rien en entrée et ne renvoie rien.
 // Les fichiers sont sauvegardés dans ~/mikrotik-grafana/users/.
@@ -208,48 +114,80 @@ func (user User) saveUser() {
 	data := fmt.Sprintf("%s:%s", user.Login, user.Password)
 
 	// Création du dossier users/ s'il n'existe pas
-	err := os.Mkdir(strings.TrimSuffix(path, user.Name), 0700)
+	err := os.MkdirAll(strings.TrimSuffix(path, user.Name), 0700)
 	if err != nil {
-		log.Fatalf("--- Erreur lors de la création du dossier 'users': %s", err)
+		fatal("erreur lors de la création du dossier 'users'", "error", err)
 	}
 
 	// Création du fichier
 	file, err := os.Create(path)
 	if err != nil {
-		log.Fatalf("--- Erreur lors de la création du fichier utilisateur : %s", err)
+		fatal("erreur lors de la création du fichier utilisateur", "error", err)
 	}
 	defer file.Close()
 
 	// Ecriture du fichier
 	_, err = file.Write([]byte(data))
 	if err != nil {
-		log.Fatalf("--- Erreur lors de la sauvegarde de l'utilisateur: %s", err)
+		fatal("erreur lors de la sauvegarde de l'utilisateur", "error", err)
+	}
+}
+
+// Renvoie la liste des utilisateurs Grafana qui ont accès à au moins un routeur, sans doublons.
+// Prend en entrée les routeurs ([]Router) et les groupes de la configuration (map nom -> membres), renvoie les noms d'utilisateurs ([]string).
+// Les membres des groupes ne sont inclus que si le groupe est associé à un routeur.
+func collectUsers(dataRouters []Router, groups map[string][]string) []string {
+
+	var res []string
+	seen := make(map[string]bool)
+
+	for _, v := range dataRouters {
+		names := append([]string{v.Username}, v.Users...)
+		for _, g := range v.Groups {
+			members, ok := groups[g]
+			if !ok {
+				logger.Warn("groupe absent de mikromap.json", "group", g, "ip", v.IP)
+			}
+			names = append(names, members...)
+		}
+
+		// Les logins Grafana ne tiennent pas compte de la casse.
+		for _, n := range names {
+			if n == "" || seen[strings.ToLower(n)] {
+				continue
+			}
+			seen[strings.ToLower(n)] = true
+			res = append(res, n)
+		}
 	}
+
+	return res
 }
 
-// Parcourt routers.json et fait un call à l'API d'admin Grafana pour chaque nom d'utilisateur.
+// Parcourt les routeurs de l'inventaire et fait un call à l'API d'admin Grafana pour chaque utilisateur ayant accès à un routeur
+// (Username, Users et membres des Groups).
+// Prend en entrée l'inventaire (*Inventory), le mot de passe administrateur (string) et l'IP:port de Grafana (string), ne renvoie rien.
 // Si l'utilisateur existe déjà, l'API renvoie un 412 et l'utilisateur n'est pas créé.
 // Sinon l'API renvoie un 200, donc on crée le fichier qui contient la paire login:password.
-func addUsers(pass string, grafanaIP string) {
+func addUsers(inv *Inventory, pass string, grafanaIP string) {
 
 	var url string
-	dataRouters := readJSON()
 
-	fmt.Println("--- Création des utilisateurs dans Grafana...")
+	logger.Info("création des utilisateurs dans Grafana", "grafana", grafanaIP)
 
-	// Parcours de tous les routeurs
-	for _, v := range dataRouters {
+	// Parcours de tous les utilisateurs
+	for _, name := range collectUsers(inv.Routers, inv.Groups) {
 
 		// Génération du login et du password
-		login := strings.ToLower(v.Username)
+		login := strings.ToLower(name)
 		password, err := password.Generate(10, 2, 2, false, false)
 		if err != nil {
-			log.Fatalf("--- Erreur lors de la génération du mot de passe: %s", err)
+			fatal("erreur lors de la génération du mot de passe", "error", err)
 		}
 
 		// Création du nouvel utilisateur
 		newUser := User{
-			Name:     v.Username,
+			Name:     name,
 			Email:    login,
 			Login:    login,
 			Password: password,
@@ -259,7 +197,7 @@ func addUsers(pass string, grafanaIP string) {
 		// Formatage du struc en JSON pour transmission à l'API
 		payload, err := json.Marshal(newUser)
 		if err != nil {
-			log.Fatalf("--- Erreur lors de la génération du payload : %s", err)
+			fatal("erreur lors de la génération du payload", "error", err)
 		}
 
 		// Formation de l'URL
@@ -268,7 +206,7 @@ func addUsers(pass string, grafanaIP string) {
 		// Requête POST à l'API
 		resp, err := http.Post(url, "application/json", bytes.NewBuffer(payload))
 		if err != nil {
-			log.Fatalf("--- Erreur lors de la requête à l'API d'administration de Grafana: %s", err)
+			fatal("erreur lors de la requête à l'API d'administration de Grafana", "error", err)
 		}
 
 		// Si le l'API a crée l'utilisateur avec succès, on crée son fichier via saveUser().
@@ -277,192 +215,248 @@ func addUsers(pass string, grafanaIP string) {
 		}
 	}
 
-	fmt.Println("--- Utilisateurs créés.")
+	logger.Info("utilisateurs créés")
+}
+
+// Découpe la saisie des utilisateurs d'un routeur.
+// Prend en entrée la saisie (string, ex: "client1, partenaire, @revendeurs") et les groupes de la configuration (map nom -> membres).
+// Renvoie le premier utilisateur (string, stocké dans Username pour rester compatible), les autres utilisateurs ([]string), les groupes ([]string)
+// et une erreur (errUsage) si un groupe n'existe pas.
+// Les noms d'utilisateurs sont mis en majuscules, les noms de groupes sont laissés tels quels.
+func parseUsers(input string, groups map[string][]string) (string, []string, []string, error) {
+
+	var username string
+	var users, groupNames []string
+
+	for _, v := range strings.Split(input, ",") {
+		v = strings.TrimSpace(v)
+		switch {
+		case v == "":
+			continue
+		case strings.HasPrefix(v, "@"):
+			name := strings.TrimPrefix(v, "@")
+			if _, ok := groups[name]; !ok {
+				return "", nil, nil, fmt.Errorf("%w: le groupe '%s' n'existe pas dans mikromap.json", errUsage, name)
+			}
+			groupNames = append(groupNames, name)
+		case username == "":
+			username = strings.ToUpper(v)
+		default:
+			users = append(users, strings.ToUpper(v))
+		}
+	}
+
+	return username, users, groupNames, nil
 }
 
-// Fonction principale qui ajoute un routeur aux fichiers.
-// Ne prend rien en entrée et ne renvoie rien.
-func addRouter() {
+// Sépare le préfixe "W" (Watchguard) de la cible saisie.
+// Prend en entrée la saisie (string) et renvoie la cible sans préfixe (string) et si le préfixe était présent (bool).
+// Le préfixe n'est reconnu que devant une adresse IP, pour ne pas tronquer les noms DNS commençant par W (ex: WEB01.exemple.fr).
+func splitWatchguard(input string) (string, bool) {
 
-	var addrPost, addrIP, username string
-	var adresse string
-	var lat, lon float64
-	var isVisible bool
+	if strings.HasPrefix(input, "W") && net.ParseIP(strings.Trim(input[1:], "[]")) != nil {
+		return input[1:], true
+	}
 
-	var isWatchguard = false
+	return input, false
+}
 
-	// Lecture fichiers
-	dataRouters := readJSON()
-	dataGlobal := readPromTargets("global_targets.json")
-	dataMikrotik := readPromTargets("mikrotik_targets.json")
+// Vérifie et normalise la cible d'un routeur.
+// Prend en entrée une cible (string) et renvoie sa forme normalisée (string) ou une erreur si ce n'est ni une adresse IP ni un nom DNS valide.
+// Les adresses IPv6 sont mises sous forme canonique (sans crochets), les noms DNS en minuscules sans point final.
+func normalizeTarget(target string) (string, error) {
 
-	fmt.Println("--- Ajouter un routeur à la supervision")
+	target = strings.TrimSpace(target)
 
-	// Récupération adresse IP
-	fmt.Print("\033[35mAdresse IP >> \033[0m")
-	_, err := fmt.Scanln(&addrIP)
-	if err != nil {
-		log.Fatalf("--- Erreur lors de la récupération de la saisie:\n%s", err)
+	// Adresse IPv4 ou IPv6
+	if ip := net.ParseIP(strings.Trim(target, "[]")); ip != nil {
+		return ip.String(), nil
 	}
 
-	// Vérification IP déjà enregistrée
-	for _, v := range dataRouters {
-		if v.IP == addrIP {
-			log.Fatal("--- Erreur: cette adresse IP existe déjà.")
+	// Nom DNS (RFC 1123)
+	name := strings.ToLower(strings.TrimSuffix(target, "."))
+	if name == "" || len(name) > 253 {
+		return "", fmt.Errorf("'%s' n'est ni une adresse IP ni un nom DNS valide", target)
+	}
+	for _, label := range strings.Split(name, ".") {
+		if len(label) == 0 || len(label) > 63 || strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return "", fmt.Errorf("'%s' n'est ni une adresse IP ni un nom DNS valide", target)
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-') {
+				return "", fmt.Errorf("'%s' n'est ni une adresse IP ni un nom DNS valide", target)
+			}
 		}
 	}
 
-	// Vérification et supression préfixe "W" pour Watchguard
-	if strings.HasPrefix(addrIP, "W") {
-		isWatchguard = true
-		addrIP = strings.TrimLeft(addrIP, "W")
-	}
+	return name, nil
+}
 
-	// Récupération adresse postale
-	fmt.Print("\033[33mAdresse postale >> \033[0m")
-	scanner := bufio.NewScanner(os.Stdin)
-	if scanner.Scan() {
-		addrPost = scanner.Text()
-	}
+// Renvoie la cible telle qu'elle doit apparaître dans les fichiers de cibles Prometheus.
+// Prend en entrée une cible normalisée (string) et la renvoie (string), entre crochets s'il s'agit d'une IPv6 (format attendu par snmp_exporter).
+func promTarget(target string) string {
 
-	// Récupération coordonnées géographiques
-	if addrPost != "" {
-		isVisible = true
-		resBody, resCode := geoAPI(addrPost)
-		if resCode != 200 {
-			log.Fatalf("--- Erreur lors de l'appel à l'API de géocodage (code %d)", resCode)
-		}
-		lat, lon, adresse = extractCoords(resBody)
-		fmt.Printf("- %s\n- %f, %f\n", adresse, lat, lon)
+	if ip := net.ParseIP(target); ip != nil && ip.To4() == nil {
+		return "[" + target + "]"
 	}
 
-	// A chaque routeur avec la même adresse, on le décale légèrement pour éviter une superposition.
-	for _, v := range dataRouters {
-		if v.Adresse == adresse {
-			lat += 0.0001
-		}
-	}
+	return target
+}
 
-	// Récupération entreprise
-	fmt.Print("\033[36mUtilisateur Grafana associé >>> \033[0m")
-	if scanner.Scan() {
-		username = scanner.Text()
-	}
+// Lecteur de l'entrée standard, partagé par les invites interactives.
+var stdin = bufio.NewScanner(os.Stdin)
 
-	// Ajout d'un nouveau routeur dans routers.json
-	newRouter := Router{
-		IP:       addrIP,
-		Lat:      lat,
-		Lon:      lon,
-		Adresse:  adresse,
-		Username: strings.ToUpper(username),
-		Statut:   0,
-		RTT:      0.0,
-		Visible:  isVisible,
-	}
+// Indique si l'entrée standard est un terminal (invites interactives possibles).
+// Ne prend rien en entrée et renvoie un booléen.
+func interactive() bool {
 
-	dataRouters = append(dataRouters, newRouter)
-	writeJSON(dataRouters)
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
 
-	// Ajout IP au job commun à tous les appareils
-	dataGlobal[0].Targets = append(dataGlobal[0].Targets, addrIP)
-	writePromTargets(dataGlobal, "global_targets.json")
+// Affiche une invite et lit la saisie de l'utilisateur.
+// Prend en entrée le texte de l'invite (string) et renvoie la saisie sans espaces autour (string)
+// ou une erreur (errUsage si l'entrée standard est fermée avant la fin de la saisie).
+func prompt(label string) (string, error) {
 
-	// Si l'adresse IP n'est pas associée à un Watchguard, l'ajouter au job spécifique aux Mikrotiks.
-	if !isWatchguard {
-		dataMikrotik[0].Targets = append(dataMikrotik[0].Targets, addrIP)
-		writePromTargets(dataMikrotik, "mikrotik_targets.json")
+	fmt.Print(label)
+	if !stdin.Scan() {
+		if stdin.Err() != nil {
+			return "", stdin.Err()
+		}
+		return "", fmt.Errorf("%w: saisie interrompue", errUsage)
 	}
 
-	fmt.Println("--- Routeur ajouté")
+	return strings.TrimSpace(stdin.Text()), nil
 }
 
-// Fonction principale qui retire un routeur des fichiers.
-// Ne prend rien en entrée et ne renvoie rien.
-func removeRouter() {
-	var addrIP string
+// Complète la saisie d'un nouveau routeur avec l'invite interactive.
+// Prend en entrée la saisie déjà connue (RouterInput, ex: options de la ligne de commande) et renvoie la saisie complétée (RouterInput) ou une erreur.
+// Seuls les champs vides sont demandés. Le type n'est pas demandé: mikrotik par défaut, le préfixe "W" devant l'IP indique un Watchguard.
+// Des coordonnées (lat, lon) peuvent être saisies à la place de l'adresse postale.
+func promptRouter(input RouterInput) (RouterInput, error) {
 
-	// Lecture fichiers
-	dataRouters := readJSON()
-	dataGlobal := readPromTargets("global_targets.json")
-	dataMikrotik := readPromTargets("mikrotik_targets.json")
-
-	fmt.Println("--- Retirer un routeur de la supervision")
+	fmt.Println("--- Ajouter un routeur à la supervision")
 
-	// Récupération adresse IP
-	fmt.Print("\033[31mAdresse IP du routeur à supprimer >>> \033[0m")
-	_, err := fmt.Scanln(&addrIP)
-	if err != nil {
-		log.Fatalf("--- Erreur lors de la récupération de la saisie:\n%s", err)
+	fields := []struct {
+		value *string
+		label string
+	}{
+		{&input.Target, "\033[35mAdresse IP ou nom DNS >> \033[0m"},
+		{&input.Address, "\033[33mAdresse postale ou coordonnées (lat, lon) >> \033[0m"},
+		{&input.Users, "\033[36mUtilisateurs Grafana associés (séparés par des virgules, @nom pour un groupe) >>> \033[0m"},
+		{&input.Parent, "\033[34mIP du routeur parent (laisser vide si aucun) >>> \033[0m"},
 	}
 
-	// Suppression de l'élément du struct dataRouters puis écriture de routers.json
-	for i, v := range dataRouters {
-		if v.IP == addrIP {
-			if i == len(dataRouters)-1 {
-				dataRouters = dataRouters[:len(dataRouters)-1]
-			} else {
-				dataRouters = append(dataRouters[0:i], dataRouters[i+1:]...)
-			}
+	for _, f := range fields {
+		if *f.value != "" {
+			continue
 		}
-	}
-	writeJSON(dataRouters)
-
-	// Suppression de l'élément du struct dataGlobal puis écriture de global_targets.json
-	for i, v := range dataGlobal[0].Targets {
-		if v == addrIP {
-			if i == len(dataGlobal)-1 {
-				dataGlobal = dataGlobal[:len(dataGlobal)-1]
-			} else {
-				dataGlobal[0].Targets = append(dataGlobal[0].Targets[0:i], dataGlobal[0].Targets[i+1:]...)
-			}
+		value, err := prompt(f.label)
+		if err != nil {
+			return input, fmt.Errorf("erreur lors de la récupération de la saisie: %w", err)
 		}
+		*f.value = value
 	}
-	writePromTargets(dataGlobal, "global_targets.json")
-
-	// Suppression de l'élément du struct dataMikrotik puis écriture de mikrotik_targets.json
-	for i, v := range dataMikrotik[0].Targets {
-		if v == addrIP {
-			if i == len(dataMikrotik)-1 {
-				dataMikrotik = dataMikrotik[:len(dataMikrotik)-1]
-			} else {
-				dataMikrotik[0].Targets = append(dataMikrotik[0].Targets[0:i], dataMikrotik[0].Targets[i+1:]...)
-			}
+
+	// Coordonnées saisies à la place de l'adresse
+	if input.Lat == nil && input.Address != "" && strings.Trim(input.Address, "0123456789.,;-+ ") == "" {
+		lat, lon, err := parseCoords(input.Address)
+		if err != nil {
+			return input, err
 		}
+		input.Lat, input.Lon, input.Address = &lat, &lon, ""
+	}
+
+	return input, nil
+}
+
+// Demande l'IP du routeur à retirer avec l'invite interactive.
+// Ne prend rien en entrée et renvoie la saisie (string) ou une erreur.
+func promptRemove() (string, error) {
+
+	fmt.Println("--- Retirer un routeur de la supervision")
+
+	ip, err := prompt("\033[31mAdresse IP du routeur à supprimer >>> \033[0m")
+	if err != nil {
+		return "", fmt.Errorf("erreur lors de la récupération de la saisie: %w", err)
 	}
-	writePromTargets(dataMikrotik, "mikrotik_targets.json")
 
-	fmt.Println("--- Routeur supprimé")
+	return ip, nil
 }
 
 func main() {
 
+	opts := Options{Pass: "admin", GrafanaIP: "127.0.0.1:3000", APIURL: "http://localhost:3333"}
+
 	// Création flags par défaut
 	var n int = 1
 	var users bool = false
-	var pass string = "admin"
-	var grafanaIP = "127.0.0.1:3000"
+	var logLevel string = "info"
+	var logFormat string = "logfmt"
+	var compliance bool = false
 
-	// Récupération des flags.
+	// Récupération des flags globaux. Les options placées après une sous-commande sont propres à celle-ci.
 	getopt.Flag(&n, 'n', "Nombre de routeurs à ajouter (ou supprimer si un nombre négatif est entré). Peut valoir 0 (si on veut uniquement créer les utilisateurs déjà dans les fichiers).\nDéfaut:")
 	getopt.FlagLong(&users, "users", 'u', "Utiliser si les utilisateurs doivent être créés automatiquement sur Grafana. Les paires login:password sont enregistrées dans mikrotik-grafana/users/.")
-	getopt.FlagLong(&pass, "pass", 'p', "Mot de passe administrateur à utiliser lors des appels à l'API d'administration de Grafana.\nDéfaut:")
-	getopt.FlagLong(&grafanaIP, "grafana", 'g', "IP:port de l'instance Grafana vers laquelle faire les appels à l'API d'administration.\nDéfaut:")
-	getopt.ParseV2()
+	getopt.FlagLong(&opts.Pass, "pass", 'p', "Mot de passe administrateur à utiliser lors des appels à l'API d'administration de Grafana.\nDéfaut:")
+	getopt.FlagLong(&opts.GrafanaIP, "grafana", 'g', "IP:port de l'instance Grafana vers laquelle faire les appels à l'API d'administration.\nDéfaut:")
+	getopt.FlagLong(&logLevel, "log-level", 0, "Niveau de log minimum (debug, info, warn, error).\nDéfaut:")
+	getopt.FlagLong(&logFormat, "log-format", 0, "Format des logs (json, logfmt).\nDéfaut:")
+	getopt.FlagLong(&compliance, "compliance", 0, "Alias de la sous-commande compliance (rapport de conformité des versions RouterOS), conservé pour les anciens scripts.")
+	getopt.FlagLong(&opts.APIURL, "api", 0, "URL de mikromap-api.\nDéfaut:")
+	getopt.FlagLong(&opts.APIToken, "api-token", 0, "Jeton d'accès à mikromap-api (http.auth.tokens), si l'authentification est activée.")
+	getopt.FlagLong(&offline, "offline", 0, "Mode hors ligne: géocoder les adresses uniquement depuis le cache et la table statique (coordonnées à saisir sinon).")
+	getopt.SetParameters("[commande [options]]")
+	getopt.SetUsage(usage)
+	err := getopt.Getopt(nil)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		usage()
+		os.Exit(exitUsage)
+	}
+
+	err = setupLogger(logLevel, logFormat)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "configuration des logs invalide:", err)
+		os.Exit(exitUsage)
+	}
+
+	// Sous-commande
+	if getopt.NArgs() > 0 {
+		exit(runCommand(&opts, getopt.Args()))
+	}
+
+	// Rapport de conformité: ancien flag, alias de la sous-commande compliance
+	if compliance {
+		exit(runCommand(&opts, []string{"compliance"}))
+	}
 
-	// Appel à addRouter() ou removeRouter() selon la valeur de n
+	// Ajout ou suppression interactive selon la valeur de n
 	if n >= 0 {
 		for i := 0; i < n; i++ {
-			addRouter()
+			input, err := promptRouter(RouterInput{})
+			if err == nil {
+				err = saveNewRouter(input)
+			}
+			if err != nil {
+				exit(err)
+			}
 		}
 	} else {
 		for i := 0; i < -n; i++ {
-			removeRouter()
+			ip, err := promptRemove()
+			if err == nil {
+				err = saveRemovedRouter(ip)
+			}
+			if err != nil {
+				exit(err)
+			}
 		}
 	}
 
 	// Appel à addUsers si le flag users est activé
 	if users {
-		addUsers(pass, grafanaIP)
+		addUsers(loadInventory(), opts.Pass, opts.GrafanaIP)
 	}
 }